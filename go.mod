@@ -2,4 +2,16 @@ module github.com/cristophercervantes/dnsaq
 
 go 1.21
 
-require github.com/miekg/dns v1.1.56
+require (
+	github.com/miekg/dns v1.1.56
+	golang.org/x/net v0.15.0
+	golang.org/x/sync v0.3.0
+	golang.org/x/time v0.3.0
+)
+
+require (
+	golang.org/x/mod v0.12.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/tools v0.13.0 // indirect
+)
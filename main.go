@@ -2,332 +2,424 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/miekg/dns"
+	"github.com/cristophercervantes/dnsaq/pkg/dnsaq"
 )
 
-// DNSConfig holds configuration for the DNS enumerator
-type DNSConfig struct {
-	Resolvers     []string
-	RateLimit     int
-	Timeout       time.Duration
-	WildcardCheck bool
-	Verbose       bool
-	OutputFile    string
+// flagSet reports whether a flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-// DNSEnumerator handles DNS resolution and enumeration
-type DNSEnumerator struct {
-	Config      *DNSConfig
-	client      *dns.Client
-	wildcardIPs map[string]bool
-	mutex       sync.Mutex
-	outputFile  *os.File
+// timeoutValue is a timeout flag value taking a duration such as 1500ms
+// or a bare number of seconds, which -t and -resolver-timeout always took.
+// Zero is only accepted by flags where it picks a default.
+type timeoutValue struct {
+	timeout   *time.Duration
+	allowZero bool
 }
 
-// NewDNSEnumerator creates a new DNS enumerator instance
-func NewDNSEnumerator(config *DNSConfig) (*DNSEnumerator, error) {
-	client := &dns.Client{
-		Timeout: config.Timeout,
-		Net:     "udp",
+func (v *timeoutValue) String() string {
+	if v.timeout == nil {
+		return time.Duration(0).String()
 	}
+	return v.timeout.String()
+}
 
-	enumerator := &DNSEnumerator{
-		Config:      config,
-		client:      client,
-		wildcardIPs: make(map[string]bool),
+func (v *timeoutValue) Set(value string) error {
+	timeout, err := time.ParseDuration(value)
+	if seconds, atoiErr := strconv.Atoi(value); atoiErr == nil {
+		timeout, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil {
+		return err
+	}
+	if timeout < 0 || timeout == 0 && !v.allowZero {
+		return fmt.Errorf("timeout must be positive")
 	}
+	*v.timeout = timeout
+	return nil
+}
 
-	// Open output file if specified
-	if config.OutputFile != "" {
-		file, err := os.OpenFile(config.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("error opening output file: %v", err)
+// timeoutFlag defines a timeoutValue flag along with an alias for it and
+// returns where the value is stored, like flag.Duration
+func timeoutFlag(name, alias string, value time.Duration, allowZero bool, usage string) *time.Duration {
+	v := &timeoutValue{timeout: &value, allowZero: allowZero}
+	flag.Var(v, name, usage)
+	flag.Var(v, alias, "Alias for -"+name)
+	return v.timeout
+}
+
+// resolversFromStdin reports whether the -r list includes stdin
+func resolversFromStdin(list string) bool {
+	for _, filename := range strings.Split(list, ",") {
+		if strings.TrimSpace(filename) == "-" {
+			return true
 		}
-		enumerator.outputFile = file
 	}
+	return false
+}
 
-	return enumerator, nil
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinPiped() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
 }
 
-// Close cleans up resources
-func (d *DNSEnumerator) Close() {
-	if d.outputFile != nil {
-		d.outputFile.Close()
+// parseFlagsConflicts lists the modes set in config that -parse-flags can't
+// drive: they make their own queries per name, so the record type and
+// flags annotated on each line would be silently ignored
+func parseFlagsConflicts(config *dnsaq.DNSConfig) []string {
+	if !config.ParseFlags {
+		return nil
+	}
+	var conflicts []string
+	if len(config.QueryTypes) > 1 {
+		conflicts = append(conflicts, "-type with several types")
+	}
+	if config.MX {
+		conflicts = append(conflicts, "-mx")
+	}
+	if config.SPF {
+		conflicts = append(conflicts, "-spf")
 	}
+	if config.SRV {
+		conflicts = append(conflicts, "-srv")
+	}
+	if config.CompareResolvers {
+		conflicts = append(conflicts, "-query-all-resolvers")
+	}
+	return conflicts
 }
 
-// LoadResolversFromFile loads DNS resolvers from a file
-func LoadResolversFromFile(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
+func main() {
+	var (
+		domain       = flag.String("d", "", "Domain to brute-force (comma-separated for several)")
+		domainList   = flag.String("dL", "", "File of base domains to brute-force, one per line")
+		permute      = flag.Bool("permute", false, "Resolve permutations of the input names built with the -w words (altdns style)")
+		recursive    = flag.Bool("recursive", false, "Brute-force the names found by -w again as new bases")
+		depth        = flag.Int("depth", 2, "Levels of brute-forcing with -recursive, counting the first pass")
+		wordlist     = flag.String("w", "", "Wordlist for brute-force")
+		listFile     = flag.String("l", "", "File of names to resolve (one per line) instead of reading stdin")
+		resolverFile = flag.String("r", "", "Comma-separated files containing DNS resolvers (one per line, - for stdin)")
+		resolverList = flag.String("resolvers", "8.8.8.8:53,1.1.1.1:53", "Comma-separated list of DNS resolvers")
+		rateLimit    = flag.Int("rate", 10, "Lookups per second, not counting retries and fallbacks (0 for unlimited)")
+		queryTimeout = timeoutFlag("query-timeout", "t", dnsaq.DefaultTimeout, false, "Time to wait for each answer once connected, as a `duration` such as 1500ms or whole seconds")
+		dialTimeout  = timeoutFlag("dial-timeout", "resolver-timeout", 0, true, "Connection setup timeout, as a `duration` such as 500ms or whole seconds (0 uses -query-timeout)")
+		noWildcard   = flag.Bool("no-wildcard", false, "Disable wildcard detection")
+		verbose      = flag.Bool("v", false, "Verbose output")
+		version      = flag.Bool("version", false, "Show version information")
+		outputFile   = flag.String("o", "", "Output file to save results")
+		webhook      = flag.String("webhook", "", "URL to POST results to as JSON Lines, in batches, alongside stdout and -o")
+		batchSize    = flag.Int("batch-size", 0, "Flush stdout and -o every N results instead of stdout after every line, for faster large runs (0 keeps per-line stdout)")
+		flushEvery   = flag.Duration("flush-interval", time.Second, "How often buffered output is flushed, whatever -batch-size says")
+		overwrite    = flag.Bool("overwrite", false, "Truncate the -o file instead of appending to it")
+		followCNAME  = flag.Int("follow-cname", 0, "Max CNAME-only answers to follow with a fresh query (0 disables)")
+		bench        = flag.Int("bench", 0, "Benchmark each resolver with this many queries for -d instead of enumerating")
+		cacheBust    = flag.Bool("cache-bust", false, "Prepend a random label to benchmark queries to force cache misses")
+		strictMatch  = flag.Bool("strict-match", false, "Reject answer records not owned by the queried name or its CNAME chain")
+		recordType   = flag.String("type", "A", "Comma-separated DNS record types to query (e.g. A,AAAA,MX)")
+		queryClass   = flag.String("class", "IN", "Query class: IN, or CH for server diagnostics such as version.bind TXT")
+		queryANY     = flag.Bool("any", false, "With several -type values, try one ANY query per name before querying each type")
+		listTypes    = flag.Bool("list-record-types", false, "List the supported record types and exit")
+		stdoutFormat = flag.String("stdout-format", dnsaq.FormatPlain, "Output format for stdout (plain, json, grep, csv)")
+		maxNameLen   = flag.Int("max-name-length", dnsaq.MaxNameLength, "Skip generated names longer than this many bytes")
+		raw          = flag.Bool("raw", false, "Output the full answer records as received instead of parsed values")
+		flagPrivate  = flag.Bool("flag-private", false, "Mark results that resolve to private, loopback or link-local addresses")
+		takeover     = flag.Bool("takeover", false, "Flag names aliased to a hosting service that looks unclaimed (possible subdomain takeover)")
+		fingerprints = flag.String("fingerprints", "", "JSON file of takeover fingerprints replacing the built-in ones (implies -takeover)")
+		showNS       = flag.Bool("show-ns", false, "Report the nameservers each result's base domain is delegated to")
+		showSOA      = flag.Bool("show-soa", false, "With -show-ns, also report the zone's SOA serial (implies -show-ns)")
+		mxMode       = flag.Bool("mx", false, "Look up the mail servers of each input domain, sorted by preference")
+		mxResolve    = flag.Bool("mx-resolve", false, "With -mx, also resolve the address of each mail server")
+		mxFallback   = flag.Bool("mx-fallback", false, "With -mx, treat a domain without MX records as its own mail server (RFC 5321)")
+		srvMode      = flag.Bool("srv", false, "Look up common SRV services (_ldap._tcp, _sip._udp, ...) under each input domain or -d")
+		srvServices  = flag.String("srv-services", "", "File of service prefixes for -srv, one per line (e.g. _ldap._tcp)")
+		spfMode      = flag.Bool("spf", false, "Flatten the SPF record of each input domain and report its DMARC policy")
+		discover     = flag.Bool("discover", false, "Query a battery of common record types per name and report which exist")
+		fileFormat   = flag.String("file-format", "", "Output format for -o (plain, json, grep, csv; default inferred from the file extension)")
+		grepFormat   = flag.Bool("grep", false, "Shorthand for -stdout-format grep")
+		jsonFormat   = flag.Bool("json", false, "Write JSON Lines to stdout and -o (unless -file-format is set)")
+		csvFormat    = flag.Bool("csv", false, "Write CSV with a header row to stdout and -o (unless -file-format is set)")
+		queryLog     = flag.String("query-log", "", "Append every query issued, with resolver, rcode, RTT and answer count, to this file")
+		queryLogJSON = flag.Bool("query-log-json", false, "Write -query-log entries as JSON Lines")
+		maxPerType   = flag.Int("max-answers-per-type", 0, "Keep at most this many answers per record type (0 keeps all)")
+		maxFailRate  = flag.Float64("max-failure-rate", 0.5, "Warn and exit with status 2 when more than this fraction of lookups fail (0 disables)")
+		matchIP      = flag.String("match-ip", "", "Only output results with an address in one of these comma-separated CIDR ranges")
+		filterIP     = flag.String("filter-ip", "", "Drop results with an address in one of these comma-separated CIDR ranges")
+		matchName    = flag.String("match-name", "", "Only output results whose name or CNAME chain matches this regular expression")
+		filterName   = flag.String("filter-name", "", "Drop results whose name or CNAME chain matches this regular expression")
+		wildcardList = flag.String("wildcard-ips", "", "Comma-separated known wildcard IPs to filter in addition to detected ones")
+		versionJSON  = flag.Bool("version-json", false, "Show build information as JSON")
+		groupByIP    = flag.Bool("group-by-ip", false, "Buffer results and print each resolved IP with the names that share it")
+		asnDB        = flag.String("asn-db", "", "File mapping prefixes or iptoasn-style address ranges to ASNs and owners, to annotate resolved IPs")
+		retries      = flag.Int("retries", 0, "Retry a lookup this many times with exponential backoff when every resolver times out or fails to connect")
+		retryJitter  = flag.Float64("retry-jitter", 1, "Fraction of each retry backoff to randomize, 0 (none) to 1 (full jitter)")
+		noDataOutput = flag.String("nodata-output", "", "Write names that exist but lack the queried type (NODATA) to this file instead of the results")
+		parseFlags   = flag.Bool("parse-flags", false, "Parse dig-style annotations on input lines, e.g. \"example.com MX +cd +norec\"")
+		maxResults   = flag.Int64("max-results", 0, "Stop after this many results have been output (0 for no limit)")
+		refreshFile  = flag.String("refresh", "", "Previous JSON output to refresh, re-resolving only stale entries")
+		refreshAge   = flag.Duration("refresh-older-than", 24*time.Hour, "Entries older than this are re-resolved by -refresh")
+		breakerMax   = flag.Int("breaker-threshold", 0, "Consecutive failures that open a resolver's circuit breaker (0 disables)")
+		breakerWait  = flag.Duration("breaker-cooldown", 30*time.Second, "How long an open resolver is skipped before a trial query")
+		noCache      = flag.Bool("no-cache", false, "Query every lookup again instead of reusing answers within their TTL")
+		queryAll     = flag.Bool("query-all-resolvers", false, "Send every query to all resolvers and report names they disagree on")
+		protocol     = flag.String("protocol", dnsaq.ProtocolAuto, "Transport for plain resolvers: udp, tcp, or auto (UDP with TCP fallback on truncation)")
+		failOnEmpty  = flag.Bool("fail-on-empty", true, "Exit with status 3 when no name resolved (-fail-on-empty=false always exits 0)")
+		dryRun       = flag.Bool("dry-run", false, "Print the names that would be looked up, after normalization and dedup, without sending any queries")
+		shuffle      = flag.Bool("shuffle", false, "Brute-force the wordlist in random order (reads it into memory)")
+		seed         = flag.Int64("seed", 0, "Seed for -shuffle, to repeat an order (0 picks one; -v prints it)")
+		strategy     = flag.String("resolver-strategy", dnsaq.StrategyRoundRobin, "Which resolver each query starts with: ordered, round-robin or random")
+		concurrency  = flag.Int("concurrency", 50, "Maximum number of lookups in flight at once")
+		cidr         = flag.String("cidr", "", "Comma-separated CIDR ranges whose addresses are looked up in -ptr mode (implies -ptr)")
+		maxCIDRHosts = flag.Int64("max-cidr-hosts", 65536, "Refuse CIDR ranges with more addresses than this unless -force is given")
+		force        = flag.Bool("force", false, "Expand CIDR ranges larger than -max-cidr-hosts")
+		ednsBufSize  = flag.Int("edns-bufsize", 1232, "EDNS0 UDP buffer size to advertise (0 sends plain DNS)")
+		dnssec       = flag.Bool("dnssec", false, "Set the DNSSEC OK bit to request signatures (needs EDNS)")
+		use0x20      = flag.Bool("0x20", false, "Randomize the case of query names and drop responses that don't echo it")
+		silent       = flag.Bool("silent", false, "Print only the names that resolved, one per line, and keep stderr quiet unless -v")
+		showEmpty    = flag.Bool("show-empty", false, "Also output names that exist but have no records of the queried type (NODATA)")
+		showNX       = flag.Bool("show-nxdomain", false, "Also output names that do not exist (NXDOMAIN)")
+		allResults   = flag.Bool("all-results", false, "Output a status for every name: resolved, NODATA, NXDOMAIN, WILDCARD or ERROR (implies -show-nxdomain and -show-empty)")
+		wcStrict     = flag.Bool("wildcard-strict", false, "Also filter names whose records exactly match a fresh random-sibling probe")
+		ptrMode      = flag.Bool("ptr", false, "Treat input lines as IP addresses and look up their PTR host names")
+		sourceIP     = flag.String("source-ip", "", "Local address to send queries from, for multi-homed hosts")
+		tlsName      = flag.String("tls-server-name", "", "Server name to verify for tls:// resolvers (defaults to the resolver host)")
+		slowQuery    = flag.Duration("slow-threshold", 0, "Log queries slower than this to stderr with the resolver that served them (0 disables)")
+		maxTime      = flag.Duration("max-time", 0, "Stop the run after this long, keeping the results so far (e.g. 30m; 0 for no limit)")
+		resumeFile   = flag.String("resume", "", "Record finished names in this file and skip the ones already in it")
+		progress     = flag.Bool("progress", false, "Print progress to stderr every few seconds (on by default with -v)")
+		showStats    = flag.Bool("stats", false, "Print a run summary to stderr (on by default with -v)")
+		ipv6         = flag.Bool("6", false, "Also resolve AAAA records for A lookups and merge both address families")
+		nsecWalk     = flag.Bool("nsec-walk", false, "Enumerate -d by walking its DNSSEC NSEC chain instead of using a wordlist")
+		axfr         = flag.Bool("axfr", false, "Attempt a zone transfer of -d from each of its nameservers instead of enumerating")
+		auditRes     = flag.Bool("audit-resolvers", false, "Check each resolver for stripped EDNS/DNSSEC data instead of enumerating")
+		auditName    = flag.String("audit-name", "cloudflare.com", "DNSSEC-signed reference name used by -audit-resolvers")
+		verifyRes    = flag.Bool("verify-resolvers", false, "Check each resolver against a control name and a name that must be NXDOMAIN, and drop those that lie")
+		verifyName   = flag.String("verify-name", "example.com", "Control name that must resolve, used by -verify-resolvers")
+	)
+	flag.BoolVar(silent, "quiet", false, "Alias for -silent")
+	flag.IntVar(breakerMax, "resolver-max-failures", 0, "Alias for -breaker-threshold")
+	flag.DurationVar(breakerWait, "resolver-cooldown", 30*time.Second, "Alias for -breaker-cooldown")
+	flag.Parse()
 
-	var resolvers []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		resolver := strings.TrimSpace(scanner.Text())
-		if resolver != "" && !strings.HasPrefix(resolver, "#") {
-			// Ensure resolver has port if not already included
-			if !strings.Contains(resolver, ":") {
-				resolver = net.JoinHostPort(resolver, "53")
-			}
-			resolvers = append(resolvers, resolver)
-		}
+	if *version {
+		fmt.Println(GetBuildInfo())
+		os.Exit(0)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if *versionJSON {
+		fmt.Println(GetBuildInfo().JSON())
+		os.Exit(0)
 	}
 
-	return resolvers, nil
-}
-
-// Resolve performs a DNS lookup for a domain
-func (d *DNSEnumerator) Resolve(domain string) ([]string, error) {
-	msg := &dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-
-	// Try each resolver until we get a response
-	for _, resolver := range d.Config.Resolvers {
-		resp, _, err := d.client.Exchange(msg, resolver)
-		if err != nil {
-			if d.Config.Verbose {
-				fmt.Fprintf(os.Stderr, "Resolver %s failed: %v\n", resolver, err)
-			}
-			continue // Try next resolver
-		}
+	if *listTypes {
+		fmt.Println(strings.Join(dnsaq.SupportedRecordTypes, "\n"))
+		os.Exit(0)
+	}
 
-		if resp.Rcode != dns.RcodeSuccess {
-			return nil, fmt.Errorf("DNS error: %v", resp.Rcode)
-		}
+	qtypes, err := dnsaq.ParseRecordTypes(*recordType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -type: %v\n", err)
+		os.Exit(1)
+	}
 
-		var ips []string
-		for _, answer := range resp.Answer {
-			if a, ok := answer.(*dns.A); ok {
-				ips = append(ips, a.A.String())
-			}
-		}
-		return ips, nil
+	if *jsonFormat {
+		*stdoutFormat = dnsaq.FormatJSON
+	}
+	if *csvFormat {
+		*stdoutFormat = dnsaq.FormatCSV
+	}
+	if *grepFormat {
+		*stdoutFormat = dnsaq.FormatGrep
+	}
+	stdoutFmt, err := dnsaq.ParseOutputFormat(*stdoutFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -stdout-format: %v\n", err)
+		os.Exit(1)
 	}
 
-	return nil, fmt.Errorf("all resolvers failed")
-}
+	qclass, err := dnsaq.ParseQueryClass(*queryClass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -class: %v\n", err)
+		os.Exit(1)
+	}
 
-// DetectWildcard checks if a domain has wildcard DNS configured
-func (d *DNSEnumerator) DetectWildcard(domain string) {
-	if !d.Config.WildcardCheck {
-		return
+	resolverStrategy, err := dnsaq.ParseResolverStrategy(*strategy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -resolver-strategy: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Test with random subdomains that likely don't exist
-	testSubdomains := []string{
-		fmt.Sprintf("rand%d-%d", time.Now().Unix(), os.Getpid()),
-		"probably-does-not-exist-123",
-		"test-subdomain-wildcard-456",
+	queryProtocol, err := dnsaq.ParseProtocol(*protocol)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -protocol: %v\n", err)
+		os.Exit(1)
 	}
 
-	for _, sub := range testSubdomains {
-		testDomain := sub + "." + domain
-		ips, err := d.Resolve(testDomain)
-		if err == nil && len(ips) > 0 {
-			d.mutex.Lock()
-			for _, ip := range ips {
-				d.wildcardIPs[ip] = true
-			}
-			d.mutex.Unlock()
+	fileFmt := dnsaq.FormatForFile(*outputFile)
+	if *jsonFormat {
+		fileFmt = dnsaq.FormatJSON
+	}
+	if *csvFormat {
+		fileFmt = dnsaq.FormatCSV
+	}
+	if *fileFormat != "" {
+		if fileFmt, err = dnsaq.ParseOutputFormat(*fileFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -file-format: %v\n", err)
+			os.Exit(1)
 		}
 	}
 
-	if len(d.wildcardIPs) > 0 && d.Config.Verbose {
-		fmt.Fprintf(os.Stderr, "[!] Wildcard DNS detected. These IPs will be filtered: %v\n", d.getWildcardIPs())
+	if *ednsBufSize != 0 && (*ednsBufSize < 512 || *ednsBufSize > 65535) {
+		fmt.Fprintln(os.Stderr, "-edns-bufsize must be 0 or between 512 and 65535")
+		os.Exit(1)
+	}
+	if *dnssec && *ednsBufSize == 0 {
+		fmt.Fprintln(os.Stderr, "-dnssec needs EDNS; set -edns-bufsize")
+		os.Exit(1)
 	}
-}
 
-func (d *DNSEnumerator) getWildcardIPs() []string {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-	
-	ips := make([]string, 0, len(d.wildcardIPs))
-	for ip := range d.wildcardIPs {
-		ips = append(ips, ip)
+	if *recursive && *depth < 1 {
+		fmt.Fprintln(os.Stderr, "-depth must be at least 1")
+		os.Exit(1)
 	}
-	return ips
-}
 
-func (d *DNSEnumerator) isWildcardResponse(ips []string) bool {
-	if len(d.wildcardIPs) == 0 {
-		return false
+	if *maxNameLen < 1 || *maxNameLen > dnsaq.MaxNameLength {
+		fmt.Fprintf(os.Stderr, "-max-name-length must be between 1 and %d\n", dnsaq.MaxNameLength)
+		os.Exit(1)
 	}
 
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-	
-	for _, ip := range ips {
-		if d.wildcardIPs[ip] {
-			return true
-		}
+	if *rateLimit < 0 {
+		fmt.Fprintln(os.Stderr, "-rate must be 0 (unlimited) or a positive number of queries per second")
+		os.Exit(1)
 	}
-	return false
-}
 
-// WriteOutput writes results to both stdout and output file (if specified)
-func (d *DNSEnumerator) WriteOutput(result string) {
-	fmt.Println(result)
-	if d.outputFile != nil {
-		d.outputFile.WriteString(result + "\n")
+	if *batchSize < 0 || *flushEvery <= 0 {
+		fmt.Fprintln(os.Stderr, "-batch-size must be 0 or more and -flush-interval positive")
+		os.Exit(1)
 	}
-}
 
-// ProcessDomain resolves a domain and sends results to the channel
-func (d *DNSEnumerator) ProcessDomain(domain string, results chan<- string) {
-	ips, err := d.Resolve(domain)
-	if err != nil {
-		if d.Config.Verbose {
-			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", domain, err)
-		}
-		return
+	if *retryJitter < 0 || *retryJitter > 1 {
+		fmt.Fprintln(os.Stderr, "-retry-jitter must be between 0 and 1")
+		os.Exit(1)
 	}
 
-	// Skip wildcard responses if enabled
-	if d.Config.WildcardCheck && d.isWildcardResponse(ips) {
-		if d.Config.Verbose {
-			fmt.Fprintf(os.Stderr, "Filtered wildcard response for %s: %v\n", domain, ips)
+	var source net.IP
+	if *sourceIP != "" {
+		if source, err = dnsaq.ParseSourceIP(*sourceIP); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -source-ip: %v\n", err)
+			os.Exit(1)
 		}
-		return
 	}
 
-	results <- fmt.Sprintf("%s [%s]", domain, strings.Join(ips, ", "))
-}
-
-// EnumerateFromReader processes domains from a reader (stdin or file)
-func (d *DNSEnumerator) EnumerateFromReader(reader *bufio.Reader) {
-	// Rate limiting
-	limiter := time.Tick(time.Second / time.Duration(d.Config.RateLimit))
-	results := make(chan string, 100)
-	
-	// Process results
-	go func() {
-		for result := range results {
-			d.WriteOutput(result)
-		}
-	}()
-
-	var wg sync.WaitGroup
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		domain := strings.TrimSpace(scanner.Text())
-		if domain == "" {
-			continue
-		}
-		
-		// Extract base domain for wildcard detection
-		if d.Config.WildcardCheck {
-			parts := strings.Split(domain, ".")
-			if len(parts) >= 2 {
-				baseDomain := parts[len(parts)-2] + "." + parts[len(parts)-1]
-				d.DetectWildcard(baseDomain)
+	var wildcardIPs []string
+	if *wildcardList != "" {
+		for _, entry := range strings.Split(*wildcardList, ",") {
+			ip := net.ParseIP(strings.TrimSpace(entry))
+			if ip == nil {
+				fmt.Fprintf(os.Stderr, "Invalid -wildcard-ips entry: %q\n", entry)
+				os.Exit(1)
 			}
+			wildcardIPs = append(wildcardIPs, ip.String())
 		}
-		
-		<-limiter
-		wg.Add(1)
-		go func(dmn string) {
-			defer wg.Done()
-			d.ProcessDomain(dmn, results)
-		}(domain)
 	}
 
-	wg.Wait()
-	close(results)
-}
-
-// Bruteforce performs subdomain brute-forcing
-func (d *DNSEnumerator) Bruteforce(domain string, wordlistPath string) {
-	d.DetectWildcard(domain)
-
-	file, err := os.Open(wordlistPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening wordlist: %v\n", err)
-		return
-	}
-	defer file.Close()
-
-	limiter := time.Tick(time.Second / time.Duration(d.Config.RateLimit))
-	results := make(chan string, 100)
-	
-	// Process results
-	go func() {
-		for result := range results {
-			d.WriteOutput(result)
+	var matchNets, filterNets []*net.IPNet
+	if *matchIP != "" {
+		if matchNets, err = dnsaq.ParseNetworks(*matchIP); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -match-ip: %v\n", err)
+			os.Exit(1)
 		}
-	}()
-
-	var wg sync.WaitGroup
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		sub := strings.TrimSpace(scanner.Text())
-		if sub == "" {
-			continue
+	}
+	if *filterIP != "" {
+		if filterNets, err = dnsaq.ParseNetworks(*filterIP); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -filter-ip: %v\n", err)
+			os.Exit(1)
 		}
-
-		fullDomain := sub + "." + domain
-		<-limiter
-		wg.Add(1)
-		go func(dmn string) {
-			defer wg.Done()
-			d.ProcessDomain(dmn, results)
-		}(fullDomain)
 	}
 
-	wg.Wait()
-	close(results)
-
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+	var matchRe, filterRe *regexp.Regexp
+	if *matchName != "" {
+		if matchRe, err = regexp.Compile(*matchName); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -match-name: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *filterName != "" {
+		if filterRe, err = regexp.Compile(*filterName); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -filter-name: %v\n", err)
+			os.Exit(1)
+		}
 	}
-}
-
-func main() {
-	var (
-		domain        = flag.String("d", "", "Domain to brute-force")
-		wordlist      = flag.String("w", "", "Wordlist for brute-force")
-		resolverFile  = flag.String("r", "", "File containing DNS resolvers (one per line)")
-		resolverList  = flag.String("resolvers", "8.8.8.8:53,1.1.1.1:53", "Comma-separated list of DNS resolvers")
-		rateLimit     = flag.Int("rate", 10, "Queries per second")
-		timeout       = flag.Int("t", 2, "Timeout in seconds")
-		noWildcard    = flag.Bool("no-wildcard", false, "Disable wildcard detection")
-		verbose       = flag.Bool("v", false, "Verbose output")
-		version       = flag.Bool("version", false, "Show version information")
-		outputFile    = flag.String("o", "", "Output file to save results")
-	)
-	flag.Parse()
 
-	if *version {
-		fmt.Println("DNS Tool v1.0.0")
-		os.Exit(0)
+	if *dryRun {
+		if *axfr || *nsecWalk || *auditRes || *verifyRes || *bench > 0 {
+			fmt.Fprintln(os.Stderr, "-dry-run can't preview -axfr, -nsec-walk, -audit-resolvers, -verify-resolvers or -bench, which need to query")
+			os.Exit(1)
+		}
+		if *recursive && (!*silent || *verbose) {
+			fmt.Fprintln(os.Stderr, "Note: -dry-run lists the first -recursive level only; deeper bases come from names that resolve")
+		}
 	}
 
 	// Load resolvers
 	var resolvers []string
+	tiers := make(map[string]int)
 	if *resolverFile != "" {
-		fileResolvers, err := LoadResolversFromFile(*resolverFile)
+		fileResolvers, fileTiers, skipped, err := dnsaq.LoadResolverFiles(*resolverFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading resolvers from file: %v\n", err)
 			os.Exit(1)
 		}
-		resolvers = fileResolvers
+		if skipped > 0 && *verbose {
+			fmt.Fprintf(os.Stderr, "Skipped %d malformed resolver lines\n", skipped)
+		}
+		resolvers, tiers = fileResolvers, fileTiers
 	} else {
-		resolvers = strings.Split(*resolverList, ",")
+		// Check every entry before giving up so all typos are reported at once
+		var invalid []string
+		for _, entry := range strings.Split(*resolverList, ",") {
+			tier, entry, err := dnsaq.ParseResolverTier(entry)
+			if err != nil {
+				invalid = append(invalid, err.Error())
+				continue
+			}
+			resolver, err := dnsaq.NormalizeResolver(entry)
+			if err != nil {
+				invalid = append(invalid, err.Error())
+				continue
+			}
+			if _, seen := tiers[resolver]; !seen {
+				tiers[resolver] = tier
+			}
+			resolvers = append(resolvers, resolver)
+		}
+		if len(invalid) > 0 {
+			fmt.Fprintln(os.Stderr, "Invalid -resolvers entries:")
+			for _, msg := range invalid {
+				fmt.Fprintf(os.Stderr, "  %s\n", msg)
+			}
+			os.Exit(1)
+		}
 	}
 
 	// Validate we have resolvers
@@ -336,40 +428,244 @@ func main() {
 		os.Exit(1)
 	}
 
-	config := &DNSConfig{
-		Resolvers:     resolvers,
-		RateLimit:     *rateLimit,
-		Timeout:       time.Duration(*timeout) * time.Second,
-		WildcardCheck: !*noWildcard,
-		Verbose:       *verbose,
-		OutputFile:    *outputFile,
+	config := &dnsaq.DNSConfig{
+		Resolvers:         resolvers,
+		RateLimit:         *rateLimit,
+		Timeout:           *queryTimeout,
+		WildcardCheck:     !*noWildcard,
+		Verbose:           *verbose,
+		OutputFile:        *outputFile,
+		FollowCNAME:       *followCNAME,
+		StrictMatch:       *strictMatch,
+		QueryType:         qtypes[0],
+		QueryTypes:        qtypes,
+		StdoutFormat:      stdoutFmt,
+		FileFormat:        fileFmt,
+		MaxNameLength:     *maxNameLen,
+		Raw:               *raw,
+		FlagPrivate:       *flagPrivate,
+		Takeover:          *takeover || *fingerprints != "",
+		FingerprintsFile:  *fingerprints,
+		Discover:          *discover,
+		QueryLog:          *queryLog,
+		QueryLogJSON:      *queryLogJSON,
+		MaxAnswersPerType: *maxPerType,
+		MaxFailureRate:    *maxFailRate,
+		WildcardIPs:       wildcardIPs,
+		GroupByIP:         *groupByIP,
+		Retries:           *retries,
+		RetryJitter:       *retryJitter,
+		NoDataOutput:      *noDataOutput,
+		DialTimeout:       *dialTimeout,
+		ParseFlags:        *parseFlags,
+		MaxResults:        *maxResults,
+		BreakerThreshold:  *breakerMax,
+		BreakerCooldown:   *breakerWait,
+		IPv6:              *ipv6,
+		Stats:             *showStats || (*verbose && !flagSet("stats")),
+		TLSServerName:     *tlsName,
+		PTR:               *ptrMode || *cidr != "",
+		WildcardStrict:    *wcStrict,
+		EDNSBufSize:       *ednsBufSize,
+		DNSSEC:            *dnssec,
+		ShowNXDomain:      *showNX || *allResults,
+		ShowEmpty:         *showEmpty || *allResults,
+		AllResults:        *allResults,
+		Silent:            *silent,
+		Recursive:         *recursive,
+		Depth:             *depth,
+		Overwrite:         *overwrite,
+		SlowThreshold:     *slowQuery,
+		SourceIP:          source,
+		Progress:          *progress,
+		ResumeFile:        *resumeFile,
+		QueryANY:          *queryANY,
+		ShowNS:            *showNS || *showSOA,
+		ShowSOA:           *showSOA,
+		Randomize0x20:     *use0x20,
+		MX:                *mxMode,
+		MXResolve:         *mxResolve,
+		MXFallback:        *mxFallback,
+		SPF:               *spfMode,
+		SRV:               *srvMode,
+		SRVServicesFile:   *srvServices,
+		MaxCIDRHosts:      *maxCIDRHosts,
+		Force:             *force,
+		Concurrency:       *concurrency,
+		ResolverStrategy:  resolverStrategy,
+		ResolverTiers:     tiers,
+		Shuffle:           *shuffle,
+		DryRun:            *dryRun,
+		Webhook:           *webhook,
+		ASNDB:             *asnDB,
+		QueryClass:        qclass,
+		BatchSize:         *batchSize,
+		FlushInterval:     *flushEvery,
+		Seed:              *seed,
+		Protocol:          queryProtocol,
+		CompareResolvers:  *queryAll,
+		NoCache:           *noCache,
+		MatchIP:           matchNets,
+		FilterIP:          filterNets,
+		MatchName:         matchRe,
+		FilterName:        filterRe,
 	}
 
-	enumerator, err := NewDNSEnumerator(config)
+	if conflicts := parseFlagsConflicts(config); len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "-parse-flags can't be combined with %s, which ignore the type and flags on each line\n", strings.Join(conflicts, ", "))
+		os.Exit(1)
+	}
+
+	enumerator, err := dnsaq.NewDNSEnumerator(config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing DNS enumerator: %v\n", err)
 		os.Exit(1)
 	}
 	defer enumerator.Close()
 
-	if *domain != "" && *wordlist != "" {
+	if *verifyRes && enumerator.VerifyResolvers(*verifyName) == 0 {
+		fmt.Fprintln(os.Stderr, "No resolvers passed -verify-resolvers")
+		enumerator.Close()
+		os.Exit(1)
+	}
+
+	if *verbose {
+		connect := *dialTimeout
+		if connect == 0 {
+			connect = *queryTimeout
+		}
+		fmt.Fprintf(os.Stderr, "Timeouts: %v to connect, %v per query; a lookup takes at most %v (%d resolvers, %d attempts)\n",
+			connect, *queryTimeout, enumerator.LookupBudget(), len(config.Resolvers), *retries+1)
+	}
+
+	// The first Ctrl-C stops the run cleanly: no new names are dispatched,
+	// queries in flight are abandoned and the results so far are written
+	// out. A second one kills the process.
+	ctx, release := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, release)
+
+	// -max-time stops the run the same way once the deadline passes
+	if *maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxTime)
+		defer cancel()
+	}
+
+	if *axfr {
+		if *domain == "" {
+			fmt.Fprintln(os.Stderr, "-axfr requires -d")
+			os.Exit(1)
+		}
+		enumerator.AttemptAXFR(ctx, *domain)
+	} else if *nsecWalk {
+		if *domain == "" {
+			fmt.Fprintln(os.Stderr, "-nsec-walk requires -d")
+			os.Exit(1)
+		}
+		enumerator.WalkNSEC(ctx, *domain)
+	} else if *auditRes {
+		enumerator.AuditResolvers(ctx, *auditName)
+	} else if *refreshFile != "" {
+		enumerator.Refresh(ctx, *refreshFile, *refreshAge)
+	} else if *bench > 0 {
+		if *domain == "" {
+			fmt.Fprintln(os.Stderr, "-bench requires -d")
+			os.Exit(1)
+		}
+		enumerator.BenchmarkResolvers(ctx, *domain, *bench, *cacheBust)
+	} else if *cidr != "" {
+		// Ranges go through the same pipeline as CIDR lines on stdin
+		ranges := strings.ReplaceAll(*cidr, ",", "\n")
+		enumerator.EnumerateFromReader(ctx, bufio.NewReader(strings.NewReader(ranges)))
+	} else if *srvMode && *domain != "" && *wordlist == "" {
+		// The -d domains are the input names of -srv
+		domains := strings.ReplaceAll(*domain, ",", "\n")
+		enumerator.EnumerateFromReader(ctx, bufio.NewReader(strings.NewReader(domains)))
+	} else if *permute {
+		if *wordlist == "" {
+			fmt.Fprintln(os.Stderr, "-permute requires -w")
+			os.Exit(1)
+		}
+		input := os.Stdin
+		if *listFile != "" {
+			if input, err = os.Open(*listFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening -l: %v\n", err)
+				os.Exit(1)
+			}
+			defer input.Close()
+		} else if !stdinPiped() {
+			fmt.Fprintln(os.Stderr, "-permute reads known names from -l or piped stdin")
+			os.Exit(1)
+		}
+		enumerator.Permute(ctx, bufio.NewReader(input), *wordlist)
+	} else if (*domain != "" || *domainList != "") && *wordlist != "" {
 		// Brute-force subdomains
-		enumerator.Bruteforce(*domain, *wordlist)
+		domains, err := dnsaq.LoadDomains(*domain, *domainList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading -dL: %v\n", err)
+			os.Exit(1)
+		}
+		if len(domains) == 0 {
+			fmt.Fprintln(os.Stderr, "No base domains to brute-force")
+			os.Exit(1)
+		}
+		enumerator.BruteforceDomains(ctx, domains, *wordlist)
+	} else if *listFile != "" {
+		if stdinPiped() && !resolversFromStdin(*resolverFile) && (!*silent || *verbose) {
+			fmt.Fprintln(os.Stderr, "Warning: reading names from -l; piped stdin is ignored")
+		}
+		file, err := os.Open(*listFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening -l: %v\n", err)
+			os.Exit(1)
+		}
+		enumerator.EnumerateFromReader(ctx, bufio.NewReader(file))
+		file.Close()
 	} else {
 		// Read from stdin
-		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) == 0 {
+		if resolversFromStdin(*resolverFile) {
+			fmt.Fprintln(os.Stderr, "Resolvers were read from stdin (-r -); give names with -l or -d and -w")
+			os.Exit(1)
+		}
+		if stdinPiped() {
 			// Data is being piped in
-			enumerator.EnumerateFromReader(bufio.NewReader(os.Stdin))
+			enumerator.EnumerateFromReader(ctx, bufio.NewReader(os.Stdin))
 		} else {
 			fmt.Fprintln(os.Stderr, "DNS Tool - Fast DNS resolution and subdomain enumeration")
 			fmt.Fprintln(os.Stderr, "Usage: dns-tool -d example.com -w wordlist.txt -r resolvers.txt")
 			fmt.Fprintln(os.Stderr, "       subfinder -d example.com | dns-tool -r resolvers.txt")
 			fmt.Fprintln(os.Stderr, "       cat domains.txt | dns-tool -r resolvers.txt")
+			fmt.Fprintln(os.Stderr, "       dns-tool -l domains.txt -r resolvers.txt")
 			fmt.Fprintln(os.Stderr, "")
 			fmt.Fprintln(os.Stderr, "Options:")
 			flag.PrintDefaults()
 			os.Exit(1)
 		}
 	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if !*silent || *verbose {
+			fmt.Fprintf(os.Stderr, "Reached -max-time %v after %d names were processed\n", *maxTime, enumerator.Processed())
+		}
+	} else if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d names were processed\n", enumerator.Processed())
+		enumerator.Close()
+		os.Exit(130)
+	}
+
+	if !enumerator.Healthy() {
+		enumerator.Close()
+		os.Exit(2)
+	}
+
+	// A run that found nothing fails, so scripts and CI gates can tell.
+	// Zone transfers, audits, benchmarks and dry runs resolve no names.
+	enumerated := !*axfr && !*auditRes && *bench == 0 && !*dryRun
+	if *failOnEmpty && enumerated && enumerator.Resolved() == 0 {
+		if !*silent || *verbose {
+			fmt.Fprintln(os.Stderr, "No names resolved")
+		}
+		enumerator.Close()
+		os.Exit(3)
+	}
 }
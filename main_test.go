@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cristophercervantes/dnsaq/pkg/dnsaq"
+	"github.com/miekg/dns"
+)
+
+func TestParseFlagsConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config dnsaq.DNSConfig
+		want   []string
+	}{
+		{"plain", dnsaq.DNSConfig{ParseFlags: true, QueryTypes: []uint16{dns.TypeA}}, nil},
+		{"modes without -parse-flags", dnsaq.DNSConfig{MX: true, QueryTypes: []uint16{dns.TypeA, dns.TypeMX}}, nil},
+		// -discover and -ptr take over from annotations in EnumerateFromReader
+		{"discover and ptr", dnsaq.DNSConfig{ParseFlags: true, Discover: true, PTR: true}, nil},
+		{"several types", dnsaq.DNSConfig{ParseFlags: true, QueryTypes: []uint16{dns.TypeA, dns.TypeAAAA}}, []string{"-type with several types"}},
+		{"mx", dnsaq.DNSConfig{ParseFlags: true, MX: true}, []string{"-mx"}},
+		{"every mode", dnsaq.DNSConfig{ParseFlags: true, SPF: true, SRV: true, CompareResolvers: true}, []string{"-spf", "-srv", "-query-all-resolvers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFlagsConflicts(&tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFlagsConflicts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		allowZero bool
+		want      time.Duration
+		ok        bool
+	}{
+		{"2", false, 2 * time.Second, true},
+		{"1500ms", false, 1500 * time.Millisecond, true},
+		{"1m", false, time.Minute, true},
+		// -query-timeout 0 would fail every dial; -dial-timeout 0 means
+		// the query timeout
+		{"0", false, 0, false},
+		{"0s", false, 0, false},
+		{"0", true, 0, true},
+		{"-1", true, 0, false},
+		{"-5s", true, 0, false},
+		{"soon", false, 0, false},
+	}
+	for _, tt := range tests {
+		var timeout time.Duration
+		v := &timeoutValue{timeout: &timeout, allowZero: tt.allowZero}
+		err := v.Set(tt.value)
+		if (err == nil) != tt.ok || timeout != tt.want {
+			t.Errorf("Set(%q) with allowZero %v = %v, %v; want %v, ok %v", tt.value, tt.allowZero, timeout, err, tt.want, tt.ok)
+		}
+	}
+}
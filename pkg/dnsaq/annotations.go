@@ -0,0 +1,55 @@
+package dnsaq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// QueryFlags overrides header bits for a single query. The zero value
+// sends the default query: recursion desired, checking enabled.
+type QueryFlags struct {
+	NoRecursion      bool
+	CheckingDisabled bool
+}
+
+// apply sets the header bits on an outgoing query
+func (f QueryFlags) apply(msg *dns.Msg) {
+	msg.RecursionDesired = !f.NoRecursion
+	msg.CheckingDisabled = f.CheckingDisabled
+}
+
+// ParseAnnotatedLine splits a dig-style input line such as
+// "example.com MX +cd +norec" into the name, record type and header flags.
+// The type is optional and defaults to qtype; flags follow dig's spelling.
+func ParseAnnotatedLine(line string, qtype uint16) (string, uint16, QueryFlags, error) {
+	var flags QueryFlags
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", 0, flags, fmt.Errorf("empty line")
+	}
+
+	for _, field := range fields[1:] {
+		switch strings.ToLower(field) {
+		case "+cd":
+			flags.CheckingDisabled = true
+		case "+nocd":
+			flags.CheckingDisabled = false
+		case "+rec":
+			flags.NoRecursion = false
+		case "+norec":
+			flags.NoRecursion = true
+		default:
+			if strings.HasPrefix(field, "+") {
+				return "", 0, flags, fmt.Errorf("unknown query flag %q", field)
+			}
+			parsed, err := ParseRecordType(field)
+			if err != nil {
+				return "", 0, flags, err
+			}
+			qtype = parsed
+		}
+	}
+	return fields[0], qtype, flags, nil
+}
@@ -0,0 +1,259 @@
+package dnsaq
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Owner is the network an address belongs to according to -asn-db
+type Owner struct {
+	// Prefix is the most specific database prefix holding the address
+	Prefix string `json:"prefix"`
+	ASN    uint32 `json:"asn,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// String renders the owner as shown in plain output, e.g. "AS13335 CLOUDFLARENET"
+func (o Owner) String() string {
+	switch {
+	case o.ASN == 0 && o.Name == "":
+		return o.Prefix
+	case o.ASN == 0:
+		return o.Name
+	case o.Name == "":
+		return fmt.Sprintf("AS%d", o.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", o.ASN, o.Name)
+}
+
+// ownerNode is a node of the binary prefix trie behind -asn-db. A node at
+// depth n stands for the prefix of the first n bits on the path to it.
+type ownerNode struct {
+	children [2]*ownerNode
+	owner    *Owner
+}
+
+// ownerTrie maps addresses to their owners by longest-prefix match, so a
+// lookup costs at most one step per address bit however large the database
+type ownerTrie struct {
+	v4, v6  ownerNode
+	entries int
+}
+
+// insert records owner for prefix, replacing an earlier entry for the same
+// prefix
+func (t *ownerTrie) insert(prefix netip.Prefix, owner Owner) {
+	prefix = prefix.Masked()
+	owner.Prefix = prefix.String()
+	node := t.root(prefix.Addr())
+	addr := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := addr[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &ownerNode{}
+		}
+		node = node.children[bit]
+	}
+	if node.owner == nil {
+		t.entries++
+	}
+	node.owner = &owner
+}
+
+// lookup returns the owner of the most specific prefix holding addr
+func (t *ownerTrie) lookup(addr netip.Addr) *Owner {
+	addr = addr.Unmap()
+	node := t.root(addr)
+	found := node.owner
+	octets := addr.AsSlice()
+	for i := 0; i < addr.BitLen() && node != nil; i++ {
+		node = node.children[octets[i/8]>>(7-i%8)&1]
+		if node != nil && node.owner != nil {
+			found = node.owner
+		}
+	}
+	return found
+}
+
+func (t *ownerTrie) root(addr netip.Addr) *ownerNode {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// readOwners parses an -asn-db file. Each line is either a prefix with an
+// optional ASN and the owner's name:
+//
+//	104.16.0.0/13 AS13335 CLOUDFLARENET
+//	10.0.0.0/8 corporate LAN
+//
+// or an address range in the iptoasn.com TSV layout, whose unrouted (AS0)
+// ranges are left out:
+//
+//	1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+func readOwners(reader io.Reader) (*ownerTrie, error) {
+	trie := &ownerTrie{}
+	scanner := newLineReader(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := trie.add(line); err != nil {
+			return nil, fmt.Errorf("%q: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// add inserts the prefixes of one database line
+func (t *ownerTrie) add(line string) error {
+	fields := strings.Fields(line)
+	if strings.Contains(fields[0], "/") {
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return err
+		}
+		owner := Owner{}
+		rest := fields[1:]
+		if len(rest) > 0 {
+			if asn, ok := parseASN(rest[0]); ok {
+				owner.ASN, rest = asn, rest[1:]
+			}
+		}
+		owner.Name = strings.Join(rest, " ")
+		t.insert(prefix, owner)
+		return nil
+	}
+
+	if len(fields) < 3 {
+		return fmt.Errorf("want a prefix or a start address, end address and ASN, got %q", line)
+	}
+	start, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return err
+	}
+	end, err := netip.ParseAddr(fields[1])
+	if err != nil {
+		return err
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.BitLen() != end.BitLen() || end.Less(start) {
+		return fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	asn, ok := parseASN(fields[2])
+	if !ok {
+		return fmt.Errorf("invalid ASN %q", fields[2])
+	}
+	if asn == 0 {
+		return nil
+	}
+
+	// The country code sits between the ASN and the name in iptoasn files
+	owner := Owner{ASN: asn}
+	if len(fields) > 4 {
+		owner.Name = strings.Join(fields[4:], " ")
+	}
+	for _, prefix := range rangePrefixes(start, end) {
+		t.insert(prefix, owner)
+	}
+	return nil
+}
+
+// parseASN reads an AS number written as "13335" or "AS13335"
+func parseASN(field string) (uint32, bool) {
+	digits := strings.TrimPrefix(strings.ToUpper(field), "AS")
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	return uint32(asn), err == nil
+}
+
+// rangePrefixes splits the address range start-end into the fewest
+// prefixes covering exactly that range
+func rangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// The largest aligned block starting at start that ends by end
+		bits := start.BitLen()
+		for bits > 0 {
+			wider := netip.PrefixFrom(start, bits-1).Masked()
+			if wider.Addr() != start || end.Less(lastAddr(wider)) {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix)
+
+		last := lastAddr(prefix)
+		if last == end {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr returns the highest address of prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(addr)*8; i++ {
+		addr[i/8] |= 1 << (7 - i%8)
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
+}
+
+// lookupOwners returns the -asn-db owner of each address in records,
+// keyed by address, or nil without -asn-db or when none of them is in the
+// database
+func (d *DNSEnumerator) lookupOwners(records []string) map[string]Owner {
+	if d.owners == nil {
+		return nil
+	}
+	var owners map[string]Owner
+	for _, record := range records {
+		addr, err := netip.ParseAddr(record)
+		if err != nil {
+			continue
+		}
+		if owner := d.owners.lookup(addr); owner != nil {
+			if owners == nil {
+				owners = make(map[string]Owner)
+			}
+			owners[record] = *owner
+		}
+	}
+	return owners
+}
+
+// resultAddresses returns the addresses a result resolved to
+func resultAddresses(result Result) []string {
+	if result.Inventory != nil {
+		return append(append([]string(nil), result.Inventory["A"]...), result.Inventory["AAAA"]...)
+	}
+	return result.Records
+}
+
+// formatOwners renders the distinct owners of addresses in order, e.g.
+// "AS13335 CLOUDFLARENET, AS16509 AMAZON-02"
+func formatOwners(addresses []string, owners map[string]Owner) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		owner, ok := owners[address]
+		if !ok {
+			continue
+		}
+		if name := owner.String(); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
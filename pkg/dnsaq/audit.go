@@ -0,0 +1,106 @@
+package dnsaq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// auditBufSize is the EDNS buffer size advertised by audit queries; an
+// EDNS-capable resolver should fit any answer smaller than this over UDP
+const auditBufSize = 4096
+
+// ResolverAudit holds the EDNS and DNSSEC capability findings for one resolver
+type ResolverAudit struct {
+	Resolver string
+	// EDNS is set when the response carried an OPT record
+	EDNS bool
+	// DOBit is set when the resolver echoed the DNSSEC OK bit
+	DOBit bool
+	// DNSSEC is set when RRSIG records came back for the signed reference name
+	DNSSEC bool
+	// SpuriousTC is set when the response was truncated even though the full
+	// answer fits in the advertised buffer
+	SpuriousTC bool
+	Err        error
+}
+
+// Findings lists the capability problems found, empty for a healthy resolver
+func (a ResolverAudit) Findings() []string {
+	var findings []string
+	if !a.EDNS {
+		findings = append(findings, "strips EDNS")
+	} else if !a.DOBit {
+		findings = append(findings, "ignores DO bit")
+	}
+	if !a.DNSSEC {
+		findings = append(findings, "strips DNSSEC records")
+	}
+	if a.SpuriousTC {
+		findings = append(findings, "truncates below advertised buffer")
+	}
+	return findings
+}
+
+// AuditResolver queries resolver for a DNSSEC-signed reference name with
+// EDNS0 and the DO bit set, and checks that what comes back matches what an
+// EDNS-capable, DNSSEC-aware resolver returns
+func (d *DNSEnumerator) AuditResolver(resolver, reference string) ResolverAudit {
+	audit := ResolverAudit{Resolver: resolver}
+
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(reference), dns.TypeA)
+	msg.SetEdns0(auditBufSize, true)
+
+	d.wait()
+	resp, _, err := d.exchange(d.client, msg, resolver)
+	if err != nil {
+		audit.Err = err
+		return audit
+	}
+
+	if resp.Truncated {
+		d.wait()
+		full, _, err := d.exchange(d.tcpClient, msg, resolver)
+		if err == nil {
+			audit.SpuriousTC = full.Len() <= auditBufSize
+			resp = full
+		}
+	}
+
+	if opt := resp.IsEdns0(); opt != nil {
+		audit.EDNS = true
+		audit.DOBit = opt.Do()
+	}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			audit.DNSSEC = true
+			break
+		}
+	}
+	return audit
+}
+
+// AuditResolvers audits every configured resolver and writes one line of
+// findings per resolver, stopping before the next resolver once ctx is
+// cancelled
+func (d *DNSEnumerator) AuditResolvers(ctx context.Context, reference string) {
+	defer d.stopWith(ctx)()
+
+	for _, resolver := range d.Config.Resolvers {
+		if d.stopped() {
+			return
+		}
+		audit := d.AuditResolver(resolver, reference)
+		switch findings := audit.Findings(); {
+		case audit.Err != nil:
+			d.writeLine(fmt.Sprintf("%s [ERROR] %v", resolver, audit.Err))
+		case len(findings) == 0:
+			d.writeLine(fmt.Sprintf("%s [OK] EDNS and DNSSEC intact", resolver))
+		default:
+			d.writeLine(fmt.Sprintf("%s [DEGRADED] %s", resolver, strings.Join(findings, ", ")))
+		}
+	}
+}
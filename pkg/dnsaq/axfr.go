@@ -0,0 +1,107 @@
+package dnsaq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// AttemptAXFR tries a zone transfer of domain from every address of every
+// one of its nameservers and reports per server whether it was allowed.
+// Servers that refuse or drop the transfer are reported and skipped. No
+// further transfers are attempted once ctx is cancelled.
+func (d *DNSEnumerator) AttemptAXFR(ctx context.Context, domain string) {
+	defer d.stopWith(ctx)()
+
+	servers, err := d.ResolveType(domain, dns.TypeNS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error looking up NS records for %s: %v\n", domain, err)
+		return
+	}
+	if len(servers) == 0 {
+		fmt.Fprintf(os.Stderr, "No NS records found for %s\n", domain)
+		return
+	}
+
+	for _, server := range servers {
+		if d.stopped() {
+			return
+		}
+		addrs, err := d.ResolveType(server, dns.TypeA)
+		if d.Config.IPv6 {
+			if v6, err6 := d.ResolveType(server, dns.TypeAAAA); err6 == nil {
+				addrs, err = append(addrs, v6...), nil
+			}
+		}
+		if err != nil || len(addrs) == 0 {
+			fmt.Fprintf(os.Stderr, "Error resolving nameserver %s: %v\n", server, err)
+			continue
+		}
+
+		for _, addr := range addrs {
+			if d.stopped() {
+				return
+			}
+			d.transferFrom(domain, server, addr)
+		}
+	}
+}
+
+// transferFrom attempts one AXFR of zone from the nameserver at addr and
+// writes the outcome, followed by every record when the transfer succeeds
+func (d *DNSEnumerator) transferFrom(zone, server, addr string) {
+	msg := &dns.Msg{}
+	msg.SetAxfr(dns.Fqdn(zone))
+	transfer := &dns.Transfer{
+		DialTimeout:  dialTimeout(d.Config),
+		ReadTimeout:  d.Config.Timeout,
+		WriteTimeout: d.Config.Timeout,
+	}
+	target := net.JoinHostPort(addr, "53")
+
+	d.wait()
+	start := time.Now()
+	var records []dns.RR
+	// Dialing through the TCP client keeps transfers on -source-ip too
+	conn, err := d.dial(d.tcpClient, target)
+	var envelopes chan *dns.Envelope
+	if err == nil {
+		defer conn.Close()
+		transfer.Conn = conn
+		envelopes, err = transfer.In(msg, target)
+	}
+	if err == nil {
+		for envelope := range envelopes {
+			if envelope.Error != nil && err == nil {
+				err = envelope.Error
+			}
+			records = append(records, envelope.RR...)
+		}
+	}
+
+	// Transfers bypass exchange, so account for them here
+	d.stats.countQuery(err)
+	if d.queryLog != nil {
+		d.logQuery(msg, target, &dns.Msg{Answer: records}, time.Since(start), err)
+	}
+
+	label := fmt.Sprintf("%s (%s)", strings.TrimSuffix(server, "."), addr)
+	if err != nil || len(records) == 0 {
+		reason := "empty transfer"
+		if err != nil {
+			reason = err.Error()
+		}
+		d.writeLine(fmt.Sprintf("%s [AXFR REFUSED] %s", label, reason))
+		return
+	}
+
+	d.writeLine(fmt.Sprintf("%s [AXFR ALLOWED] %d records", label, len(records)))
+	for _, rr := range records {
+		d.writeLine(rr.String())
+	}
+}
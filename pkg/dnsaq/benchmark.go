@@ -0,0 +1,63 @@
+package dnsaq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// BenchmarkResolvers measures query latency against each resolver.
+// With cacheBust set, every query is for a fresh random label under domain so
+// the resolver has to go to the authoritative servers instead of its cache.
+// This is a measurement aid only and never feeds the enumeration output.
+// Cancelling ctx ends the benchmark without reporting the resolver in progress.
+func (d *DNSEnumerator) BenchmarkResolvers(ctx context.Context, domain string, count int, cacheBust bool) {
+	defer d.stopWith(ctx)()
+
+	for _, resolver := range d.Config.Resolvers {
+		var total, fastest, slowest time.Duration
+		var succeeded, failed int
+
+		for i := 0; i < count; i++ {
+			name := domain
+			if cacheBust {
+				name = d.randomLabel() + "." + domain
+			}
+
+			msg := &dns.Msg{}
+			msg.SetQuestion(dns.Fqdn(name), dns.TypeA)
+
+			d.wait()
+			if d.stopped() {
+				return
+			}
+			_, rtt, err := d.exchange(d.client, msg, resolver)
+			if err != nil {
+				failed++
+				if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "Benchmark query %s via %s failed: %v\n", name, resolver, err)
+				}
+				continue
+			}
+
+			succeeded++
+			total += rtt
+			if fastest == 0 || rtt < fastest {
+				fastest = rtt
+			}
+			if rtt > slowest {
+				slowest = rtt
+			}
+		}
+
+		var avg time.Duration
+		if succeeded > 0 {
+			avg = total / time.Duration(succeeded)
+		}
+		d.writeLine(fmt.Sprintf("%s ok=%d failed=%d min=%v avg=%v max=%v",
+			resolver, succeeded, failed, fastest, avg, slowest))
+	}
+}
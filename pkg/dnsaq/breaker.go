@@ -0,0 +1,114 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// breakerState is the state of a per-resolver circuit breaker
+type breakerState int
+
+const (
+	// breakerClosed passes queries through normally
+	breakerClosed breakerState = iota
+	// breakerOpen skips the resolver entirely until the cooldown elapses
+	breakerOpen
+	// breakerHalfOpen lets a single trial query through to decide whether
+	// the resolver has recovered
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// resolverBreaker tracks the health of one resolver
+type resolverBreaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allowResolver reports whether a query may be sent to resolver. An open
+// breaker whose cooldown has elapsed moves to half-open and admits exactly
+// one trial query; everyone else skips the resolver until the trial settles.
+func (d *DNSEnumerator) allowResolver(resolver string) bool {
+	if d.Config.BreakerThreshold <= 0 {
+		return true
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	breaker := d.breakers[resolver]
+	if breaker == nil {
+		return true
+	}
+
+	switch breaker.state {
+	case breakerOpen:
+		if time.Since(breaker.openedAt) < d.Config.BreakerCooldown {
+			return false
+		}
+		d.setBreakerState(resolver, breaker, breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// recordResolverResult feeds the outcome of a query into the resolver's
+// breaker. Only transport failures count; any response, whatever its rcode,
+// shows the resolver is alive.
+func (d *DNSEnumerator) recordResolverResult(resolver string, ok bool) {
+	if d.Config.BreakerThreshold <= 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	breaker := d.breakers[resolver]
+	if breaker == nil {
+		breaker = &resolverBreaker{}
+		d.breakers[resolver] = breaker
+	}
+
+	if ok {
+		breaker.failures = 0
+		if breaker.state != breakerClosed {
+			d.setBreakerState(resolver, breaker, breakerClosed)
+		}
+		return
+	}
+
+	breaker.failures++
+	if breaker.state == breakerHalfOpen || breaker.failures >= d.Config.BreakerThreshold {
+		breaker.openedAt = time.Now()
+		d.setBreakerState(resolver, breaker, breakerOpen)
+	}
+}
+
+// setBreakerState moves a breaker to a new state, logging the transition
+// under -v. The caller must hold the mutex.
+func (d *DNSEnumerator) setBreakerState(resolver string, breaker *resolverBreaker, state breakerState) {
+	if d.Config.Verbose && breaker.state != state {
+		switch state {
+		case breakerOpen:
+			fmt.Fprintf(os.Stderr, "Resolver %s ejected after %d consecutive failures, re-probing in %v\n", resolver, breaker.failures, d.Config.BreakerCooldown)
+		case breakerHalfOpen:
+			fmt.Fprintf(os.Stderr, "Resolver %s cooldown over, sending a trial query\n", resolver)
+		case breakerClosed:
+			fmt.Fprintf(os.Stderr, "Resolver %s restored\n", resolver)
+		}
+	}
+	breaker.state = state
+}
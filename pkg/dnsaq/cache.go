@@ -0,0 +1,69 @@
+package dnsaq
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// answerCache keeps answers until the smallest TTL among their records runs
+// out, so overlapping candidates from -recursive or -permute and repeated
+// input names cost one lookup per TTL window. Answers without records, and
+// failed lookups, are never cached.
+type answerCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAnswer
+	stats   *Stats
+}
+
+// cachedAnswer is an answer and the time it stops being valid
+type cachedAnswer struct {
+	answer  *Answer
+	expires time.Time
+}
+
+func newAnswerCache(stats *Stats) *answerCache {
+	return &answerCache{entries: make(map[string]cachedAnswer), stats: stats}
+}
+
+// get returns the cached answer for key if it is still valid, counting the
+// hit or miss. A nil cache (-no-cache) always misses without counting.
+func (c *answerCache) get(key string) (*Answer, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		atomic.AddInt64(&c.stats.CacheHits, 1)
+		return entry.answer, true
+	}
+	atomic.AddInt64(&c.stats.CacheMisses, 1)
+	return nil, false
+}
+
+// put caches answer under key for the lowest TTL of its records
+func (c *answerCache) put(key string, answer *Answer) {
+	if c == nil || len(answer.RRs) == 0 {
+		return
+	}
+
+	ttl := answer.RRs[0].Header().Ttl
+	for _, rr := range answer.RRs[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	if ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedAnswer{answer: answer, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+}
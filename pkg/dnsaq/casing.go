@@ -0,0 +1,53 @@
+package dnsaq
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// errCaseMismatch is returned under -0x20 when a response does not echo the
+// exact casing of the question, the mark of an off-path spoofing attempt
+var errCaseMismatch = errors.New("response does not echo the 0x20 query casing; dropped as spoofed")
+
+// randomizeCase returns name with each letter upper- or lower-cased at
+// random (draft-vixie-dnsext-dns0x20), adding entropy an off-path attacker
+// has to guess
+func randomizeCase(name string) string {
+	mixed := []byte(name)
+	for i, c := range mixed {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.Intn(2) == 0 {
+			mixed[i] = c ^ 0x20
+		}
+	}
+	return string(mixed)
+}
+
+// with0x20 returns a copy of msg whose question name is randomly cased
+func with0x20(msg *dns.Msg) *dns.Msg {
+	mixed := msg.Copy()
+	mixed.Question[0].Name = randomizeCase(msg.Question[0].Name)
+	return mixed
+}
+
+// check0x20 verifies that resp echoes the casing sent in query, then puts
+// the original casing back on the question and on records owned by it so
+// the rest of the pipeline sees the name as it was asked
+func check0x20(query, resp *dns.Msg, original string) error {
+	sent := query.Question[0].Name
+	if len(resp.Question) == 0 || resp.Question[0].Name != sent {
+		return errCaseMismatch
+	}
+
+	resp.Question[0].Name = original
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if strings.EqualFold(rr.Header().Name, sent) {
+				rr.Header().Name = original
+			}
+		}
+	}
+	return nil
+}
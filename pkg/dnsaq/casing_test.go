@@ -0,0 +1,58 @@
+package dnsaq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRandomize0x20DropsMiscasedResponse(t *testing.T) {
+	// A spoofer that guessed the name but not its casing answers lower-case
+	spoofer := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Question[0].Name = strings.ToLower(m.Question[0].Name)
+		rr, _ := dns.NewRR(m.Question[0].Name + " 60 IN A 192.0.2.66")
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+	// Enough letters that the random casing is never all lower-case in practice
+	const name = "abcdefghijklmnopqrstuvwxyz.example.test"
+	honest := newMockServer(t, zoneHandler(map[string][]string{
+		name + ". A": {name + ". 60 IN A 192.0.2.1"},
+	}))
+
+	t.Run("alone", func(t *testing.T) {
+		d := newTestEnumerator(t, []string{spoofer.Addr}, func(config *DNSConfig) {
+			config.Randomize0x20 = true
+		})
+		if records, err := d.Resolve(name); err == nil {
+			t.Errorf("Resolve = %v, want the miscased answer dropped", records)
+		}
+	})
+
+	t.Run("with an honest resolver", func(t *testing.T) {
+		d := newTestEnumerator(t, []string{spoofer.Addr, honest.Addr}, func(config *DNSConfig) {
+			config.Randomize0x20 = true
+		})
+		answer, err := d.Lookup(name, dns.TypeA)
+		if err != nil {
+			t.Fatalf("Lookup: %v", err)
+		}
+		if answer.Resolver != honest.Addr || !reflect.DeepEqual(answer.Records, []string{"192.0.2.1"}) {
+			t.Errorf("Lookup = %v from %s, want 192.0.2.1 from the honest resolver", answer.Records, answer.Resolver)
+		}
+		// The answer carries the name as it was asked, not the random casing
+		if owner := answer.RRs[0].Header().Name; owner != name+"." {
+			t.Errorf("answer owner = %q, want %q", owner, name+".")
+		}
+	})
+
+	for _, query := range spoofer.Queries() {
+		if sent := query.Question.Name; sent == strings.ToLower(sent) {
+			t.Errorf("query for %q went out without mixed casing", sent)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package dnsaq
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// cidrSize returns the number of host addresses expandCIDR yields for
+// prefix, saturating at 1<<63 for huge IPv6 prefixes
+func cidrSize(prefix netip.Prefix) uint64 {
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 63 {
+		return 1 << 63
+	}
+	size := uint64(1) << hostBits
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		size -= 2 // network and broadcast addresses
+	}
+	return size
+}
+
+// parseCIDR parses a CIDR range, refusing ranges larger than -max-cidr-hosts
+// unless -force is given
+func (d *DNSEnumerator) parseCIDR(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	prefix = prefix.Masked()
+
+	if size := cidrSize(prefix); !d.Config.Force && d.Config.MaxCIDRHosts > 0 && size > uint64(d.Config.MaxCIDRHosts) {
+		return netip.Prefix{}, fmt.Errorf("%s has %d addresses, more than -max-cidr-hosts %d (use -force to expand it anyway)", prefix, size, d.Config.MaxCIDRHosts)
+	}
+	return prefix, nil
+}
+
+// expandCIDR calls visit with every host address in prefix, in order, until
+// visit returns false. For IPv4 ranges of four or more addresses the network
+// and broadcast addresses are left out. Addresses are generated one at a
+// time, so a /8 costs no more memory than a /24.
+func expandCIDR(prefix netip.Prefix, visit func(ip string) bool) {
+	addr := prefix.Addr()
+	skipEdges := addr.Is4() && prefix.Bits() <= 30
+	if skipEdges {
+		addr = addr.Next()
+	}
+
+	for ; addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		if skipEdges && !prefix.Contains(addr.Next()) {
+			return // broadcast
+		}
+		if !visit(addr.String()) {
+			return
+		}
+	}
+}
+
+// enumerateCIDR queues a PTR lookup for every host address in cidr. It
+// reports false once the run has been stopped.
+func (d *DNSEnumerator) enumerateCIDR(cidr string, pool *workerPool, results chan<- Result) bool {
+	prefix, err := d.parseCIDR(cidr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping %q: %v\n", cidr, err)
+		return true
+	}
+
+	expandCIDR(prefix, func(ip string) bool {
+		if d.stopped() {
+			return false
+		}
+		d.wait()
+		pool.Submit(func() {
+			if !d.dryRun(ip) {
+				d.processPTR(ip, results)
+			}
+		})
+		return true
+	})
+	return !d.stopped()
+}
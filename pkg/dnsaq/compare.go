@@ -0,0 +1,204 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ResolverAnswer is what one resolver answered in -query-all-resolvers mode
+type ResolverAnswer struct {
+	Resolver string   `json:"resolver"`
+	Records  []string `json:"records"`
+	// Status is the rcode or error of a resolver that gave no records
+	Status string `json:"status,omitempty"`
+}
+
+// sameAnswer reports whether two resolvers gave the same answer, ignoring
+// record order
+func (a ResolverAnswer) sameAnswer(b ResolverAnswer) bool {
+	return a.Status == b.Status && sameRecords(a.Records, b.Records)
+}
+
+// processCompare sends every query type for domain to all resolvers at once
+// for -query-all-resolvers. Names they agree on are reported as usual;
+// disagreements, the mark of geo-DNS, split-horizon views or tampering,
+// are reported as a discrepancy listing each resolver's answer.
+func (d *DNSEnumerator) processCompare(domain string, results chan<- Result) {
+	for _, qtype := range d.queryTypes() {
+		if d.stopped() {
+			return
+		}
+		d.compareQuery(domain, qtype, results)
+	}
+}
+
+// compareQuery asks every resolver for one type of domain and reports the
+// outcome
+func (d *DNSEnumerator) compareQuery(domain string, qtype uint16, results chan<- Result) {
+	answers := d.queryAllResolvers(domain, qtype)
+
+	// Resolvers that could not be reached have no view to compare
+	var answered []ResolverAnswer
+	for _, answer := range answers {
+		if answer.Status != statusError {
+			answered = append(answered, answer)
+		}
+	}
+	if len(answered) == 0 {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", domain, errAllResolversFailed)
+		}
+		return
+	}
+
+	agreed := true
+	for _, answer := range answered[1:] {
+		if !answer.sameAnswer(answered[0]) {
+			agreed = false
+			break
+		}
+	}
+
+	if agreed {
+		answer := answered[0]
+		if answer.Status == dns.RcodeToString[dns.RcodeNameError] {
+			atomic.AddInt64(&d.stats.NXDomain, 1)
+			if d.Config.ShowNXDomain {
+				d.sendResult(results, Result{
+					Domain:    domain,
+					Type:      dns.TypeToString[qtype],
+					Status:    answer.Status,
+					Timestamp: time.Now().UTC(),
+				})
+			}
+			return
+		}
+		if len(answer.Records) == 0 {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "No %s records for %s from any resolver (%s)\n", dns.TypeToString[qtype], domain, answer.Status)
+			}
+			return
+		}
+
+		d.awaitWildcard(domain)
+		if d.isWildcardResponse(domain, answer.Records) {
+			atomic.AddInt64(&d.stats.WildcardFiltered, 1)
+			return
+		}
+		atomic.AddInt64(&d.stats.Resolved, 1)
+		d.sendResult(results, Result{
+			Domain:    domain,
+			Type:      dns.TypeToString[qtype],
+			Records:   d.capAnswers(answer.Records),
+			Resolver:  answer.Resolver,
+			Timestamp: time.Now().UTC(),
+		})
+		return
+	}
+
+	// Records holds every record any resolver gave, so tools reading only
+	// the records still see all candidate addresses
+	var union []string
+	seen := make(map[string]bool)
+	for _, answer := range answers {
+		for _, record := range answer.Records {
+			if !seen[record] {
+				seen[record] = true
+				union = append(union, record)
+			}
+		}
+	}
+	if d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Resolvers disagree on %s %s\n", domain, dns.TypeToString[qtype])
+	}
+	if len(union) > 0 {
+		atomic.AddInt64(&d.stats.Resolved, 1)
+	}
+	d.sendResult(results, Result{
+		Domain:      domain,
+		Type:        dns.TypeToString[qtype],
+		Records:     union,
+		Discrepancy: true,
+		Answers:     answers,
+		Timestamp:   time.Now().UTC(),
+	})
+}
+
+// queryAllResolvers sends the same query to every resolver concurrently and
+// returns their answers in resolver order, records sorted
+func (d *DNSEnumerator) queryAllResolvers(domain string, qtype uint16) []ResolverAnswer {
+	msg := d.newQuery(domain, qtype)
+
+	answers := make([]ResolverAnswer, len(d.Config.Resolvers))
+	var wg sync.WaitGroup
+	for i, resolver := range d.Config.Resolvers {
+		if i > 0 {
+			d.wait()
+		}
+		wg.Add(1)
+		go func(i int, resolver string) {
+			defer wg.Done()
+			answers[i] = d.askResolver(msg, resolver)
+		}(i, resolver)
+	}
+	wg.Wait()
+	return answers
+}
+
+// askResolver sends msg to one resolver, re-asking a truncated answer over
+// TCP, and renders the records of the queried type
+func (d *DNSEnumerator) askResolver(msg *dns.Msg, resolver string) ResolverAnswer {
+	answer := ResolverAnswer{Resolver: resolver}
+
+	query := msg
+	if d.needsPlainDNS(resolver) {
+		query = withoutEdns0(msg)
+	}
+	resp, _, err := d.exchange(d.client, query, resolver)
+	if err == nil && resp.Truncated && d.Config.Protocol != ProtocolUDP {
+		resp, _, err = d.exchange(d.tcpClient, query, resolver)
+	}
+	if err != nil {
+		answer.Status = statusError
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Resolver %s failed: %v\n", resolver, err)
+		}
+		return answer
+	}
+
+	qtype := msg.Question[0].Qtype
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == qtype {
+			answer.Records = append(answer.Records, recordValue(rr))
+		}
+	}
+	sort.Strings(answer.Records)
+	if len(answer.Records) == 0 {
+		answer.Status = dns.RcodeToString[resp.Rcode]
+		if resp.Rcode == dns.RcodeSuccess {
+			answer.Status = statusNoData
+		}
+	}
+	return answer
+}
+
+// formatAnswers renders the per-resolver answers of a discrepancy, e.g.
+// "8.8.8.8:53=[1.2.3.4] 10.0.0.1:53=[10.0.0.5]"
+func formatAnswers(answers []ResolverAnswer) string {
+	parts := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		if len(answer.Records) == 0 {
+			parts = append(parts, fmt.Sprintf("%s=%s", answer.Resolver, answer.Status))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=[%s]", answer.Resolver, strings.Join(answer.Records, ", ")))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,71 @@
+package dnsaq
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Delegation is the nameserver set a result's base domain is delegated to,
+// as reported by -show-ns
+type Delegation struct {
+	Zone        string   `json:"zone"`
+	Nameservers []string `json:"nameservers"`
+	// Serial is the zone's SOA serial with -show-soa
+	Serial uint32 `json:"soa_serial,omitempty"`
+}
+
+// delegation returns the nameservers of the zone domain belongs to, looked
+// up once per registrable domain and cached for the rest of the run. The
+// NS set is taken from the registrable domain or, failing that, its nearest
+// ancestor that has one. It returns nil when no NS records were found.
+func (d *DNSEnumerator) delegation(domain string) *Delegation {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	base, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		base = domain
+	}
+
+	d.mutex.Lock()
+	cached, ok := d.delegations[base]
+	d.mutex.Unlock()
+	if ok {
+		return cached
+	}
+
+	// Identical lookups already in flight are shared, so concurrent results
+	// under one base cost a single NS query
+	var found *Delegation
+	for _, zone := range append([]string{dns.CanonicalName(base)}, ancestors(base)...) {
+		d.wait()
+		servers, err := d.ResolveType(zone, dns.TypeNS)
+		if err != nil && !isNXDomain(err) {
+			break
+		}
+		if len(servers) > 0 {
+			found = &Delegation{Zone: strings.TrimSuffix(zone, ".")}
+			for _, server := range servers {
+				found.Nameservers = append(found.Nameservers, strings.TrimSuffix(server, "."))
+			}
+			break
+		}
+	}
+
+	if found != nil && d.Config.ShowSOA {
+		d.wait()
+		if answer, err := d.Lookup(found.Zone, dns.TypeSOA); err == nil {
+			for _, rr := range answer.RRs {
+				if soa, ok := rr.(*dns.SOA); ok {
+					found.Serial = soa.Serial
+					break
+				}
+			}
+		}
+	}
+
+	d.mutex.Lock()
+	d.delegations[base] = found
+	d.mutex.Unlock()
+	return found
+}
@@ -0,0 +1,71 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// discoverTypes is the battery of record types queried by -discover
+var discoverTypes = []uint16{
+	dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeTXT,
+	dns.TypeNS, dns.TypeSOA, dns.TypeSRV, dns.TypeCAA,
+}
+
+// DiscoverDomain queries every type in discoverTypes for domain and returns
+// the records found per type. Types with no records are left out, so the keys
+// double as the list of types that exist for the name. Each query after the
+// first waits on the rate limiter, like any other query we send.
+func (d *DNSEnumerator) DiscoverDomain(domain string) map[string][]string {
+	inventory := make(map[string][]string)
+	for i, qtype := range discoverTypes {
+		if i > 0 {
+			d.wait()
+		}
+
+		records, err := d.ResolveType(domain, qtype)
+		if err != nil {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Error resolving %s %s: %v\n", domain, dns.TypeToString[qtype], err)
+			}
+			continue
+		}
+		if len(records) > 0 {
+			inventory[dns.TypeToString[qtype]] = d.capAnswers(records)
+		}
+	}
+	return inventory
+}
+
+// capAnswers trims records to -max-answers-per-type, keeping the inventory
+// readable for types like TXT or CDN-backed A sets that return large sets
+func (d *DNSEnumerator) capAnswers(records []string) []string {
+	if limit := d.Config.MaxAnswersPerType; limit > 0 && len(records) > limit {
+		return records[:limit]
+	}
+	return records
+}
+
+// processDiscover builds the record inventory for a domain and queues it for output
+func (d *DNSEnumerator) processDiscover(domain string, results chan<- Result) {
+	inventory := d.DiscoverDomain(domain)
+	if len(inventory) == 0 {
+		return
+	}
+
+	// A wildcard catch-all answers every name, so its A records mark it like any other result
+	d.awaitWildcard(domain)
+	if d.isWildcardResponse(domain, inventory["A"]) {
+		atomic.AddInt64(&d.stats.WildcardFiltered, 1)
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Filtered wildcard response for %s: %v\n", domain, inventory["A"])
+		}
+		return
+	}
+
+	atomic.AddInt64(&d.stats.Resolved, 1)
+	d.sendResult(results, Result{Domain: domain, Type: "DISCOVER", Inventory: inventory, Timestamp: time.Now().UTC()})
+}
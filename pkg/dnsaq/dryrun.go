@@ -0,0 +1,31 @@
+package dnsaq
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dryRun prints the name ProcessDomain would look up for domain under
+// -dry-run, reporting whether it did. The candidates go to stdout and -o
+// in place of results, as queried: A-labels, reverse names for -ptr and one
+// line per service for -srv.
+func (d *DNSEnumerator) dryRun(domain string) bool {
+	if !d.Config.DryRun {
+		return false
+	}
+
+	switch {
+	case d.Config.PTR:
+		if arpa, err := dns.ReverseAddr(domain); err == nil {
+			d.writeLine(strings.TrimSuffix(arpa, "."))
+		}
+	case d.Config.SRV:
+		for _, service := range d.srvServices {
+			d.writeLine(service + "." + strings.TrimSuffix(domain, "."))
+		}
+	default:
+		d.writeLine(domain)
+	}
+	return true
+}
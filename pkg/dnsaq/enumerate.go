@@ -0,0 +1,82 @@
+package dnsaq
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Enumerate resolves the names received on names as EnumerateFromReader
+// would, but hands the results to the caller instead of writing them out.
+// The returned channel is closed once names is closed and every lookup has
+// finished, or soon after ctx is cancelled.
+func (d *DNSEnumerator) Enumerate(ctx context.Context, names <-chan string) <-chan Result {
+	results := d.newResults()
+
+	go func() {
+		defer d.stopWith(ctx)()
+		defer close(results)
+
+		pool := d.newWorkerPool()
+		defer pool.Wait()
+		for {
+			var name string
+			var ok bool
+			select {
+			case name, ok = <-names:
+			case <-d.ctx.Done():
+			}
+			if !ok || d.stopped() {
+				return
+			}
+			host, ok := normalizeDomain(name)
+			if !ok {
+				continue
+			}
+			ascii, err := asciiName(host)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %q: %v\n", name, err)
+				continue
+			}
+			name = ascii
+
+			if !d.Config.PTR {
+				d.startWildcardChecks(name)
+			}
+			if d.alreadyDone(name) {
+				continue
+			}
+			d.wait()
+			pool.Submit(func() {
+				d.ProcessDomain(name, results)
+				d.markDone(name)
+			})
+		}
+	}()
+
+	return results
+}
+
+// ResolveNames resolves every name and returns the results once all
+// lookups have finished or ctx is cancelled
+func (d *DNSEnumerator) ResolveNames(ctx context.Context, names []string) []Result {
+	input := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(input)
+		for _, name := range names {
+			select {
+			case input <- name:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var collected []Result
+	for result := range d.Enumerate(ctx, input) {
+		collected = append(collected, result)
+	}
+	return collected
+}
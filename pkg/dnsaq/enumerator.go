@@ -0,0 +1,1734 @@
+// Package dnsaq resolves and enumerates DNS names at a controlled rate
+// across a pool of resolvers, filtering wildcard answers. It backs the
+// dnsaq command, and can be used on its own: build a DNSEnumerator from a
+// DNSConfig, then call Enumerate or ResolveNames to receive Result values
+// instead of formatted output.
+package dnsaq
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// errAllResolversFailed is returned when no resolver produced a response
+var errAllResolversFailed = errors.New("all resolvers failed")
+
+// DNSError is returned when a resolver answers with a non-success rcode
+type DNSError struct {
+	Rcode    int
+	Resolver string
+}
+
+func (e *DNSError) Error() string {
+	return fmt.Sprintf("DNS error: %s from %s", dns.RcodeToString[e.Rcode], e.Resolver)
+}
+
+// isNXDomain reports whether err says the name definitively does not exist
+func isNXDomain(err error) bool {
+	var dnsErr *DNSError
+	return errors.As(err, &dnsErr) && dnsErr.Rcode == dns.RcodeNameError
+}
+
+// failedLookup reports whether err says no resolver gave a usable answer,
+// either by not responding or by answering SERVFAIL, REFUSED or FORMERR
+func failedLookup(err error) bool {
+	var dnsErr *DNSError
+	if errors.As(err, &dnsErr) {
+		switch dnsErr.Rcode {
+		case dns.RcodeServerFailure, dns.RcodeRefused, dns.RcodeFormatError:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, errAllResolversFailed)
+}
+
+// DefaultTimeout is the query timeout used when DNSConfig.Timeout is unset
+const DefaultTimeout = 2 * time.Second
+
+// MaxNameLength is the longest name DNS allows in presentation form, and
+// the default for DNSConfig.MaxNameLength
+const MaxNameLength = 253
+
+// DNSConfig holds configuration for the DNS enumerator
+type DNSConfig struct {
+	Resolvers     []string
+	RateLimit     int
+	Timeout       time.Duration
+	WildcardCheck bool
+	Verbose       bool
+	OutputFile    string
+	FollowCNAME   int
+	StrictMatch   bool
+	QueryType     uint16
+	QueryTypes    []uint16
+	StdoutFormat  string
+	// Stdout receives the formatted results of the Enumerate* and
+	// Bruteforce* runs; nil means os.Stdout
+	Stdout            io.Writer
+	FileFormat        string
+	MaxNameLength     int
+	Raw               bool
+	FlagPrivate       bool
+	Discover          bool
+	QueryLog          string
+	QueryLogJSON      bool
+	MaxAnswersPerType int
+	MaxFailureRate    float64
+	WildcardIPs       []string
+	GroupByIP         bool
+	Retries           int
+	RetryJitter       float64
+	NoDataOutput      string
+	DialTimeout       time.Duration
+	ParseFlags        bool
+	MaxResults        int64
+	BreakerThreshold  int
+	BreakerCooldown   time.Duration
+	IPv6              bool
+	Stats             bool
+	TLSServerName     string
+	PTR               bool
+	WildcardStrict    bool
+	EDNSBufSize       int
+	DNSSEC            bool
+	ShowNXDomain      bool
+	ShowEmpty         bool
+	Silent            bool
+	Recursive         bool
+	Depth             int
+	Overwrite         bool
+	SlowThreshold     time.Duration
+	SourceIP          net.IP
+	Progress          bool
+	ResumeFile        string
+	QueryANY          bool
+	ShowNS            bool
+	Randomize0x20     bool
+	CompareResolvers  bool
+	NoCache           bool
+	SRV               bool
+	SRVServicesFile   string
+	Takeover          bool
+	FingerprintsFile  string
+	// MatchIP, FilterIP, MatchName and FilterName limit the results written
+	// to stdout and -o; unset filters keep everything
+	MatchIP    []*net.IPNet
+	FilterIP   []*net.IPNet
+	MatchName  *regexp.Regexp
+	FilterName *regexp.Regexp
+	// AllResults also outputs failed lookups and filtered wildcard answers,
+	// so every name gets a status; main sets ShowNXDomain and ShowEmpty too
+	AllResults       bool
+	ShowSOA          bool
+	MX               bool
+	MXResolve        bool
+	MXFallback       bool
+	SPF              bool
+	MaxCIDRHosts     int64
+	Force            bool
+	Concurrency      int
+	ResolverStrategy string
+	// ResolverTiers maps resolvers to their fallback tier; resolvers not in
+	// it, or all of them when it is empty, are tier 1
+	ResolverTiers map[string]int
+	// Shuffle brute-forces the wordlist in random order, seeded by Seed;
+	// a zero Seed picks one from the clock
+	Shuffle bool
+	Seed    int64
+	// DryRun prints the names a run would look up instead of querying them
+	DryRun bool
+	// Webhook is a URL that results are POSTed to as JSON Lines, in batches
+	Webhook string
+	// BatchSize flushes stdout and the output file every this many lines
+	// instead of stdout after every line; FlushInterval is how often they
+	// are flushed regardless, one second when zero
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueryClass is the class of every lookup, dns.ClassINET when zero;
+	// dns.ClassCHAOS reaches diagnostics such as version.bind
+	QueryClass uint16
+	// ASNDB is a file mapping prefixes or address ranges to their owners,
+	// which annotate the resolved addresses of results
+	ASNDB string
+	// Protocol is ProtocolAuto, ProtocolUDP or ProtocolTCP; empty means auto
+	Protocol string
+}
+
+// DNSEnumerator handles DNS resolution and enumeration
+type DNSEnumerator struct {
+	Config      *DNSConfig
+	client      *dns.Client
+	tcpClient   *dns.Client
+	tlsClient   *dns.Client
+	httpClient  *http.Client
+	wildcardIPs map[string]bool
+
+	// wildcardAnswers holds the answers to wildcard probes per parent domain
+	wildcardAnswers map[string]map[string]bool
+	mutex           sync.Mutex
+	outputFile      *os.File
+	queryLog        *os.File
+	noDataFile      *os.File
+
+	// sinks are where results are written, stdout first, guarded by mutex
+	sinks []*outputSink
+	// webhook posts the -webhook sink's batches; nil without -webhook
+	webhook *webhookWriter
+	// resume records the names processed for -resume
+	resume *resumeState
+	// flushDone stops the periodic flush of buffered sinks
+	flushDone chan struct{}
+	closeOnce sync.Once
+
+	// labelSeed is drawn once per run so generated probe labels never repeat across runs
+	labelSeed    uint32
+	labelCounter uint64
+
+	// resolverCounter rotates the starting resolver for -resolver-strategy round-robin
+	resolverCounter uint64
+	// tiered is set when ResolverTiers puts resolvers in more than one tier
+	tiered bool
+
+	// blockedSends counts result sends that waited on a full results channel
+	blockedSends int64
+
+	// stats holds the run counters; started is when the enumerator was created
+	stats   Stats
+	started time.Time
+	// progressTotal is the number of names the run will process, if known
+	progressTotal int64
+	// latency holds the RTTs of answered queries per resolver for -stats
+	latency latencies
+
+	// ctx is cancelled once the run should stop: no new work is dispatched
+	// and queries in flight are abandoned
+	ctx    context.Context
+	cancel context.CancelFunc
+	// emitted counts results written, for -max-results
+	emitted int64
+
+	// inflight collapses concurrent identical lookups into one query
+	inflight singleflight.Group
+	// srvServices are the service prefixes looked up by -srv
+	srvServices []string
+	// fingerprints are the services -takeover checks CNAME targets against
+	fingerprints []Fingerprint
+	// owners maps addresses to their network owners with -asn-db
+	owners *ownerTrie
+
+	// cache holds answers within their TTL; nil with -no-cache
+	cache *answerCache
+
+	// checkedWildcards maps each probed base domain to a channel closed
+	// once its wildcard detection has finished
+	checkedWildcards map[string]chan struct{}
+	// slots bounds worker jobs, wildcard probes and the extra goroutines of
+	// fanOut together to -concurrency, so none of them add to the lookups
+	// the workers have in flight
+	slots chan struct{}
+
+	// delegations caches the -show-ns answer per registrable domain
+	delegations map[string]*Delegation
+
+	// breakers holds the per-resolver circuit breakers
+	breakers map[string]*resolverBreaker
+
+	// noEDNS holds resolvers that answered FORMERR to EDNS queries
+	noEDNS map[string]bool
+
+	// limiter paces lookups, wildcard probes included, and is shared by
+	// every mode. It is waited on once per lookup, not per packet: the
+	// AAAA half of -6, retries, non-EDNS and TCP re-sends and CNAME
+	// follow-ups go out under the wait of the lookup that needed them.
+	limiter *rate.Limiter
+}
+
+// NewDNSEnumerator creates a new DNS enumerator instance. Unset Timeout,
+// MaxNameLength and QueryType fields of config are filled in with
+// DefaultTimeout, MaxNameLength and A queries.
+func NewDNSEnumerator(config *DNSConfig) (*DNSEnumerator, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxNameLength <= 0 {
+		config.MaxNameLength = MaxNameLength
+	}
+	if config.QueryType == 0 {
+		config.QueryType = dns.TypeA
+	}
+
+	// Connection setup and the query get separate budgets: dial applies the
+	// dial timeout, and the client's cumulative Timeout is left unset since
+	// it would override the read and write ones
+	client := &dns.Client{
+		Net:          "udp",
+		Dialer:       newDialer(config, "udp"),
+		DialTimeout:  dialTimeout(config),
+		ReadTimeout:  config.Timeout,
+		WriteTimeout: config.Timeout,
+	}
+
+	// Truncated UDP answers are re-asked over TCP with the same timeouts
+	tcpClient := *client
+	tcpClient.Net = "tcp"
+	tcpClient.Dialer = newDialer(config, "tcp")
+
+	// DNS-over-TLS resolvers verify against their host name or IP unless
+	// -tls-server-name overrides it
+	tlsClient := tcpClient
+	tlsClient.Net = "tcp-tls"
+	tlsClient.TLSConfig = &tls.Config{ServerName: config.TLSServerName}
+
+	// -protocol tcp sends every plain query over TCP, for networks that
+	// block or mangle UDP port 53
+	if config.Protocol == ProtocolTCP {
+		client = &tcpClient
+	}
+
+	enumerator := &DNSEnumerator{
+		Config:      config,
+		client:      client,
+		tcpClient:   &tcpClient,
+		tlsClient:   &tlsClient,
+		httpClient:  newHTTPClient(config),
+		wildcardIPs: make(map[string]bool),
+
+		wildcardAnswers: make(map[string]map[string]bool),
+		labelSeed:       rand.Uint32(),
+		noEDNS:          make(map[string]bool),
+
+		checkedWildcards: make(map[string]chan struct{}),
+		slots:            make(chan struct{}, max(config.Concurrency, 1)),
+		delegations:      make(map[string]*Delegation),
+		breakers:         make(map[string]*resolverBreaker),
+		started:          time.Now(),
+		limiter:          newLimiter(config.RateLimit),
+	}
+	for _, tier := range config.ResolverTiers {
+		if tier > 1 {
+			enumerator.tiered = true
+			break
+		}
+	}
+
+	enumerator.ctx, enumerator.cancel = context.WithCancel(context.Background())
+	if !config.NoCache {
+		enumerator.cache = newAnswerCache(&enumerator.stats)
+	}
+
+	// Known catch-all IPs filter from the start, even if probing later fails
+	for _, ip := range config.WildcardIPs {
+		enumerator.wildcardIPs[ip] = true
+	}
+
+	var out io.Writer = os.Stdout
+	if config.Stdout != nil {
+		out = config.Stdout
+	}
+	batch := 1
+	if config.BatchSize > 0 {
+		batch = config.BatchSize
+	}
+	stdout := newOutputSink(out, config.StdoutFormat, batch)
+	if config.Silent {
+		stdout.seen = make(map[string]bool)
+	}
+	enumerator.sinks = []*outputSink{stdout}
+
+	// Open output file if specified
+	if config.OutputFile != "" {
+		file, err := openOutputFile(config.OutputFile, config.Overwrite)
+		if err != nil {
+			return nil, fmt.Errorf("error opening output file: %v", err)
+		}
+		enumerator.outputFile = file
+		sink := newOutputSink(file, config.FileFormat, config.BatchSize)
+		// A file being appended to has its CSV header already
+		if info, err := file.Stat(); err == nil && info.Size() > 0 {
+			sink.wroteHeader = true
+		}
+		enumerator.sinks = append(enumerator.sinks, sink)
+	}
+	if config.Webhook != "" {
+		sink, webhook, err := newWebhookSink(config.Webhook)
+		if err != nil {
+			if enumerator.outputFile != nil {
+				enumerator.outputFile.Close()
+			}
+			return nil, err
+		}
+		enumerator.webhook = webhook
+		enumerator.sinks = append(enumerator.sinks, sink)
+	}
+	enumerator.flushDone = make(chan struct{})
+	go enumerator.flushPeriodically()
+
+	if config.QueryLog != "" {
+		file, err := os.OpenFile(config.QueryLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening query log: %v", err)
+		}
+		enumerator.queryLog = file
+	}
+
+	if config.NoDataOutput != "" {
+		file, err := os.OpenFile(config.NoDataOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening NODATA output file: %v", err)
+		}
+		enumerator.noDataFile = file
+	}
+
+	enumerator.srvServices = defaultSRVServices
+	if config.SRVServicesFile != "" {
+		file, err := os.Open(config.SRVServicesFile)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening SRV services file: %v", err)
+		}
+		services, err := readNames(file)
+		file.Close()
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error reading SRV services file: %v", err)
+		}
+		enumerator.srvServices = services
+	}
+
+	enumerator.fingerprints = defaultFingerprints
+	if config.FingerprintsFile != "" {
+		file, err := os.Open(config.FingerprintsFile)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening fingerprints file: %v", err)
+		}
+		fingerprints, err := readFingerprints(file)
+		file.Close()
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error reading fingerprints file: %v", err)
+		}
+		enumerator.fingerprints = fingerprints
+	}
+
+	if config.ASNDB != "" {
+		file, err := openInput(config.ASNDB)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening ASN database: %v", err)
+		}
+		owners, err := readOwners(file)
+		file.Close()
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error reading ASN database: %v", err)
+		}
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Loaded %d prefixes from %s\n", owners.entries, config.ASNDB)
+		}
+		enumerator.owners = owners
+	}
+
+	if config.ResumeFile != "" {
+		state, err := openResumeState(config.ResumeFile)
+		if err != nil {
+			enumerator.Close()
+			return nil, fmt.Errorf("error opening resume file: %v", err)
+		}
+		enumerator.resume = state
+	}
+
+	return enumerator, nil
+}
+
+// openOutputFile opens the -o file for appending, or truncates it with
+// -overwrite, creating any missing parent directories
+func openOutputFile(path string, overwrite bool) (*os.File, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, not a file", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	mode := os.O_APPEND
+	if overwrite {
+		mode = os.O_TRUNC
+	}
+	return os.OpenFile(path, mode|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// Close flushes buffered output and cleans up resources. It is safe to
+// call more than once.
+func (d *DNSEnumerator) Close() {
+	d.closeOnce.Do(func() {
+		close(d.flushDone)
+		d.flushSinks()
+		if d.webhook != nil {
+			d.mutex.Lock()
+			d.webhook.Close()
+			d.mutex.Unlock()
+		}
+		if d.outputFile != nil {
+			d.outputFile.Close()
+		}
+		if d.queryLog != nil {
+			d.queryLog.Close()
+		}
+		if d.noDataFile != nil {
+			d.noDataFile.Close()
+		}
+		if d.resume != nil {
+			d.resume.file.Close()
+		}
+	})
+}
+
+// LoadResolversFromFile loads DNS resolvers from a file
+func LoadResolversFromFile(filename string) ([]string, error) {
+	resolvers, _, _, err := loadResolvers(filename)
+	return resolvers, err
+}
+
+// LoadResolverFiles loads DNS resolvers from a comma-separated list of
+// files, where "-" reads stdin, dropping duplicates across files. It also
+// returns the tier of each resolver, from "tier:N" prefixes, and how many
+// lines were skipped.
+func LoadResolverFiles(list string) ([]string, map[string]int, int, error) {
+	tiers := make(map[string]int)
+	var resolvers []string
+	skipped := 0
+	for _, filename := range strings.Split(list, ",") {
+		filename = strings.TrimSpace(filename)
+		if filename == "" {
+			continue
+		}
+		loaded, loadedTiers, n, err := loadResolvers(filename)
+		skipped += n
+		if err != nil {
+			return nil, nil, skipped, err
+		}
+		for _, resolver := range loaded {
+			if _, seen := tiers[resolver]; !seen {
+				tiers[resolver] = loadedTiers[resolver]
+				resolvers = append(resolvers, resolver)
+			}
+		}
+	}
+	return resolvers, tiers, skipped, nil
+}
+
+// loadResolvers loads DNS resolvers from a file ("-" for stdin) and reports
+// how many malformed lines were skipped. Entries that do not parse, or whose
+// host does not resolve, are skipped with a warning rather than left to fail
+// every query.
+func loadResolvers(filename string) ([]string, map[string]int, int, error) {
+	var input io.Reader = os.Stdin
+	source := "stdin"
+	if filename != "-" {
+		file, err := openInput(filename)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		defer file.Close()
+		input, source = file, filename
+	}
+
+	var resolvers []string
+	tiers := make(map[string]int)
+	invalid := 0
+	scanner := newLineReader(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		tier, entry, err := ParseResolverTier(line)
+		var resolver string
+		if err == nil {
+			resolver, err = NormalizeResolver(entry)
+		}
+		if err == nil {
+			err = checkResolverHost(resolver)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping resolver %q from %s: %v\n", line, source, err)
+			invalid++
+			continue
+		}
+		if _, seen := tiers[resolver]; !seen {
+			tiers[resolver] = tier
+			resolvers = append(resolvers, resolver)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, scanner.Skipped + invalid, err
+	}
+
+	return resolvers, tiers, scanner.Skipped + invalid, nil
+}
+
+// Resolve performs a DNS lookup for a domain using the configured record
+// type. With -6, A lookups return the AAAA addresses as well.
+func (d *DNSEnumerator) Resolve(domain string) ([]string, error) {
+	if d.Config.QueryType == dns.TypeA && d.Config.IPv6 {
+		answer, err := d.lookupAddresses(domain, QueryFlags{})
+		if err != nil {
+			return nil, err
+		}
+		return answer.Records, nil
+	}
+	return d.ResolveType(domain, d.Config.QueryType)
+}
+
+// ResolveType performs a DNS lookup for a domain and record type
+func (d *DNSEnumerator) ResolveType(domain string, qtype uint16) ([]string, error) {
+	answer, err := d.Lookup(domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return answer.Records, nil
+}
+
+// Answer is the outcome of a successful lookup
+type Answer struct {
+	// Records holds the rendered data of every answer record of the queried type
+	Records []string
+	// RRs holds every answer record received, including followed CNAME responses
+	RRs []dns.RR
+	// Resolver is the resolver that gave the final answer
+	Resolver string
+	// NoData is set when the name exists (NOERROR) but has no records of the queried type
+	NoData bool
+	// Dangling is set when the name is a CNAME whose target does not exist (NXDOMAIN)
+	Dangling bool
+	// RTT is how long the resolver took to answer, summed over followed CNAMEs
+	RTT time.Duration
+}
+
+// Lookup performs a DNS lookup for a domain and record type, returning the
+// rendered records along with the raw answer section
+func (d *DNSEnumerator) Lookup(domain string, qtype uint16) (*Answer, error) {
+	return d.LookupWithFlags(domain, qtype, QueryFlags{})
+}
+
+// LookupWithFlags performs a DNS lookup with the given header flags
+func (d *DNSEnumerator) LookupWithFlags(domain string, qtype uint16, flags QueryFlags) (*Answer, error) {
+	return d.sharedResolve(domain, qtype, flags, d.Config.FollowCNAME)
+}
+
+// lookupAddresses queries both A and AAAA for a domain and merges the answers,
+// IPv4 first. The lookup only fails when both families fail, so IPv6-only and
+// IPv4-only hosts both resolve.
+func (d *DNSEnumerator) lookupAddresses(domain string, flags QueryFlags) (*Answer, error) {
+	v4, err4 := d.LookupWithFlags(domain, dns.TypeA, flags)
+	v6, err6 := d.LookupWithFlags(domain, dns.TypeAAAA, flags)
+	if err4 != nil && err6 != nil {
+		return nil, err4
+	}
+	if err4 != nil {
+		return v6, nil
+	}
+	if err6 != nil {
+		return v4, nil
+	}
+
+	// Both answers may be shared with other callers, so build a fresh one
+	merged := &Answer{
+		Records:  append(append([]string{}, v4.Records...), v6.Records...),
+		RRs:      append(append([]dns.RR{}, v4.RRs...), v6.RRs...),
+		Resolver: v4.Resolver,
+		NoData:   v4.NoData && v6.NoData,
+		RTT:      v4.RTT + v6.RTT,
+	}
+	if v4.NoData {
+		merged.Resolver = v6.Resolver
+	}
+	return merged, nil
+}
+
+// sharedResolve runs resolve, letting concurrent callers asking for the same
+// name and type share a single in-flight lookup, and serving answers from
+// the cache while their TTL lasts. The returned Answer may be shared and
+// must not be modified. The CNAME depth is part of the key so a looping
+// chain can never wait on its own lookup.
+func (d *DNSEnumerator) sharedResolve(domain string, qtype uint16, flags QueryFlags, depth int) (*Answer, error) {
+	key := fmt.Sprintf("%s/%s/%v/%d", dns.CanonicalName(domain), dns.TypeToString[qtype], flags, depth)
+	if answer, ok := d.cache.get(key); ok {
+		return answer, nil
+	}
+	answer, err, _ := d.inflight.Do(key, func() (interface{}, error) {
+		answer, err := d.resolve(domain, qtype, flags, depth)
+		atomic.AddInt64(&d.stats.Lookups, 1)
+		if failedLookup(err) {
+			atomic.AddInt64(&d.stats.FailedLookups, 1)
+		}
+		if err == nil {
+			d.cache.put(key, answer)
+		}
+		return answer, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return answer.(*Answer), nil
+}
+
+// newQuery builds the query for domain in the -class, with EDNS0 when an
+// -edns-bufsize is set
+func (d *DNSEnumerator) newQuery(domain string, qtype uint16) *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(domain), qtype)
+	if d.Config.QueryClass != 0 {
+		msg.Question[0].Qclass = d.Config.QueryClass
+	}
+	if d.Config.EDNSBufSize > 0 {
+		msg.SetEdns0(uint16(d.Config.EDNSBufSize), d.Config.DNSSEC)
+	}
+	return msg
+}
+
+// resolve performs the lookup, chasing up to depth CNAME-only answers
+func (d *DNSEnumerator) resolve(domain string, qtype uint16, flags QueryFlags, depth int) (*Answer, error) {
+	msg := d.newQuery(domain, qtype)
+	flags.apply(msg)
+
+	var lastErr error
+	for attempt := 0; attempt <= d.Config.Retries; attempt++ {
+		if attempt > 0 {
+			delay := d.retryDelay(attempt)
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Retrying %s in %v (attempt %d/%d)\n", domain, delay, attempt, d.Config.Retries)
+			}
+			select {
+			case <-time.After(delay):
+			case <-d.ctx.Done():
+				return nil, d.ctx.Err()
+			}
+		}
+
+		// Try each resolver until we get a response. Another pass is only
+		// worth it if some resolver failed in a way that may clear up.
+		transient := false
+		for _, resolver := range d.resolverOrder() {
+			if !d.allowResolver(resolver) {
+				transient = true
+				continue
+			}
+
+			query := msg
+			if d.needsPlainDNS(resolver) {
+				query = withoutEdns0(msg)
+			}
+
+			resp, rtt, err := d.exchange(d.client, query, resolver)
+			if d.stopped() {
+				return nil, d.ctx.Err()
+			}
+			d.recordResolverResult(resolver, err == nil)
+			if err != nil {
+				if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "Resolver %s failed: %v\n", resolver, err)
+				}
+				if retryable(err) {
+					transient = true
+				}
+				continue // Try next resolver
+			}
+
+			// Some old resolvers answer FORMERR to any query carrying an OPT record,
+			// so give them one classic 512-byte query before trusting the rcode
+			if resp.Rcode == dns.RcodeFormatError && query.IsEdns0() != nil {
+				query = withoutEdns0(msg)
+				plain, plainRTT, err := d.exchange(d.client, query, resolver)
+				if err != nil {
+					if d.Config.Verbose {
+						fmt.Fprintf(os.Stderr, "Resolver %s answered FORMERR for %s and failed without EDNS: %v\n", resolver, domain, err)
+					}
+					lastErr = &DNSError{Rcode: resp.Rcode, Resolver: resolver}
+					if retryable(err) {
+						transient = true
+					}
+					continue
+				}
+				d.markNoEDNS(resolver)
+				resp = plain
+				rtt += plainRTT
+			}
+
+			// A truncated answer is missing records, so fetch the full one over
+			// TCP unless -protocol udp rules it out
+			if resp.Truncated && d.Config.Protocol == ProtocolUDP {
+				if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "Keeping truncated answer for %s from %s (-protocol udp)\n", domain, resolver)
+				}
+			} else if resp.Truncated {
+				full, fullRTT, err := d.exchange(d.tcpClient, query, resolver)
+				if err == nil {
+					resp = full
+					rtt += fullRTT
+				} else if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "TCP retry of truncated answer for %s from %s failed: %v\n", domain, resolver, err)
+				}
+			}
+
+			// An alias to a name that doesn't exist is a takeover candidate, not a miss
+			if resp.Rcode == dns.RcodeNameError && len(cnameChain(msg.Question[0].Name, resp.Answer)) > 0 {
+				return &Answer{RRs: resp.Answer, Resolver: resolver, Dangling: true, RTT: rtt}, nil
+			}
+
+			if resp.Rcode != dns.RcodeSuccess {
+				answerErr := &DNSError{Rcode: resp.Rcode, Resolver: resolver}
+
+				// SERVFAIL and REFUSED say more about this resolver than about
+				// the name, so another resolver may still answer
+				if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+					if d.Config.Verbose {
+						fmt.Fprintf(os.Stderr, "Resolver %s answered %s for %s\n", resolver, dns.RcodeToString[resp.Rcode], domain)
+					}
+					lastErr = answerErr
+					transient = true
+					continue
+				}
+				return nil, answerErr
+			}
+
+			var owners map[string]bool
+			if d.Config.StrictMatch {
+				owners = chainOwners(msg.Question[0].Name, resp.Answer)
+			}
+
+			var records []string
+			var target string
+			for _, answer := range resp.Answer {
+				if owners != nil && !owners[dns.CanonicalName(answer.Header().Name)] {
+					if d.Config.Verbose {
+						fmt.Fprintf(os.Stderr, "Rejected out-of-chain record for %s from %s: %s\n", domain, resolver, answer)
+					}
+					continue
+				}
+
+				if answer.Header().Rrtype == qtype {
+					records = append(records, recordValue(answer))
+				} else if cname, ok := answer.(*dns.CNAME); ok {
+					target = cname.Target
+				}
+			}
+
+			// Non-recursive servers answer with the CNAME alone, so query its target ourselves
+			if len(records) == 0 && target != "" && depth > 0 {
+				if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "Following CNAME %s -> %s\n", domain, target)
+				}
+				followed, err := d.sharedResolve(target, qtype, flags, depth-1)
+				if isNXDomain(err) {
+					return &Answer{RRs: resp.Answer, Resolver: resolver, Dangling: true, RTT: rtt}, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				chained := *followed
+				chained.RRs = append(resp.Answer, followed.RRs...)
+				chained.RTT += rtt
+				return &chained, nil
+			}
+			return &Answer{Records: records, RRs: resp.Answer, Resolver: resolver, NoData: len(records) == 0, RTT: rtt}, nil
+		}
+
+		if !transient {
+			break
+		}
+	}
+
+	// Resolvers that answered at all, just not usefully, explain the failure best
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errAllResolversFailed
+}
+
+// withoutEdns0 returns a copy of msg with its OPT record removed
+func withoutEdns0(msg *dns.Msg) *dns.Msg {
+	plain := msg.Copy()
+	plain.Extra = plain.Extra[:0]
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			plain.Extra = append(plain.Extra, rr)
+		}
+	}
+	return plain
+}
+
+// markNoEDNS records that a resolver needed the non-EDNS fallback
+func (d *DNSEnumerator) markNoEDNS(resolver string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Concurrent FORMERRs from the same resolver count it once
+	if !d.noEDNS[resolver] {
+		atomic.AddInt64(&d.stats.EDNSFallbacks, 1)
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Resolver %s rejected EDNS with FORMERR, falling back to plain DNS\n", resolver)
+		}
+	}
+	d.noEDNS[resolver] = true
+}
+
+// needsPlainDNS reports whether a resolver already rejected EDNS this run,
+// so its queries go out without an OPT record from the start
+func (d *DNSEnumerator) needsPlainDNS(resolver string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.noEDNS[resolver]
+}
+
+// Stop makes the enumeration loops stop dispatching new domains and cancels
+// the queries in flight, whose answers are discarded. Only results already
+// produced are drained and flushed to the outputs.
+func (d *DNSEnumerator) Stop() {
+	d.cancel()
+}
+
+// newLimiter paces queries at perSecond, or not at all when it is 0
+func newLimiter(perSecond int) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
+
+// wait blocks until the rate limiter lets the next lookup go, or the run stops
+func (d *DNSEnumerator) wait() {
+	// -dry-run sends nothing, so there is nothing to pace
+	if d.Config.DryRun {
+		return
+	}
+	d.limiter.Wait(d.ctx)
+}
+
+func (d *DNSEnumerator) stopped() bool {
+	return d.ctx.Err() != nil
+}
+
+// stopWith stops the run once ctx is done. The returned function releases
+// the watch and must be called when the run ends.
+func (d *DNSEnumerator) stopWith(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, d.Stop)
+}
+
+// reportRun prints end-of-run diagnostics to stderr
+func (d *DNSEnumerator) reportRun() {
+	d.reportBackpressure()
+	d.reportResume()
+
+	d.mutex.Lock()
+	fallbacks := len(d.noEDNS)
+	d.mutex.Unlock()
+	// -stats reports the same count
+	if fallbacks > 0 && d.Config.Verbose && !d.Config.Stats {
+		fmt.Fprintf(os.Stderr, "%d resolvers needed the non-EDNS fallback\n", fallbacks)
+	}
+
+	if d.Config.Stats {
+		d.reportStats()
+	}
+
+	if !d.Healthy() && !d.quiet() {
+		fmt.Fprintf(os.Stderr, "[!] %.0f%% of lookups failed on every resolver; results may be incomplete. Consider more reliable resolvers, a lower -rate or a higher -t\n",
+			d.failureRate()*100)
+	}
+}
+
+// quiet reports whether -silent should suppress non-essential stderr output
+func (d *DNSEnumerator) quiet() bool {
+	return d.Config.Silent && !d.Config.Verbose
+}
+
+// Processed returns how many names have been fully looked up so far
+func (d *DNSEnumerator) Processed() int64 {
+	return atomic.LoadInt64(&d.stats.Processed)
+}
+
+// Resolved returns how many names have resolved so far
+func (d *DNSEnumerator) Resolved() int64 {
+	return atomic.LoadInt64(&d.stats.Resolved)
+}
+
+// failureRate returns the fraction of lookups where no resolver gave a
+// usable answer
+func (d *DNSEnumerator) failureRate() float64 {
+	lookups := atomic.LoadInt64(&d.stats.Lookups)
+	if lookups == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&d.stats.FailedLookups)) / float64(lookups)
+}
+
+// Healthy reports whether the failure rate stayed within -max-failure-rate
+func (d *DNSEnumerator) Healthy() bool {
+	return d.Config.MaxFailureRate <= 0 || d.failureRate() <= d.Config.MaxFailureRate
+}
+
+// chainOwners returns the owner names that legitimately answer qname: qname
+// itself plus every CNAME target reachable from it within the answer section
+func chainOwners(qname string, answers []dns.RR) map[string]bool {
+	targets := make(map[string]string)
+	for _, answer := range answers {
+		if cname, ok := answer.(*dns.CNAME); ok {
+			targets[dns.CanonicalName(cname.Hdr.Name)] = dns.CanonicalName(cname.Target)
+		}
+	}
+
+	owners := make(map[string]bool)
+	for name := dns.CanonicalName(qname); name != "" && !owners[name]; name = targets[name] {
+		owners[name] = true
+	}
+	return owners
+}
+
+// cnameChain returns the CNAME targets followed from qname within the answer
+// section, in order, e.g. [cdn.example.net edge.example.org]
+func cnameChain(qname string, answers []dns.RR) []string {
+	targets := make(map[string]string)
+	for _, answer := range answers {
+		if cname, ok := answer.(*dns.CNAME); ok {
+			targets[dns.CanonicalName(cname.Hdr.Name)] = cname.Target
+		}
+	}
+
+	var chain []string
+	seen := make(map[string]bool)
+	for name := dns.CanonicalName(qname); !seen[name]; {
+		seen[name] = true
+		target, ok := targets[name]
+		if !ok {
+			break
+		}
+		chain = append(chain, strings.TrimSuffix(target, "."))
+		name = dns.CanonicalName(target)
+	}
+	return chain
+}
+
+// DetectWildcard checks if a domain has wildcard DNS configured. Answers to
+// the probes are remembered for domain only, so a wildcard at one level never
+// filters names elsewhere.
+func (d *DNSEnumerator) DetectWildcard(domain string) {
+	if !d.Config.WildcardCheck {
+		return
+	}
+
+	// Test with random subdomains that likely don't exist
+	testSubdomains := []string{
+		d.randomLabel(),
+		"probably-does-not-exist-123",
+		"test-subdomain-wildcard-456",
+	}
+
+	found := make(map[string]bool)
+	for _, sub := range testSubdomains {
+		testDomain := sub + "." + domain
+		if !d.validName(testDomain) {
+			continue
+		}
+
+		d.wait()
+		ips, err := d.Resolve(testDomain)
+		if err == nil {
+			for _, ip := range ips {
+				found[ip] = true
+			}
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	d.wildcardAnswers[dns.CanonicalName(domain)] = found
+	d.mutex.Unlock()
+
+	if d.Config.Verbose {
+		ips := make([]string, 0, len(found))
+		for ip := range found {
+			ips = append(ips, ip)
+		}
+		fmt.Fprintf(os.Stderr, "[!] Wildcard DNS detected at *.%s. These IPs will be filtered: %v\n", strings.TrimSuffix(domain, "."), ips)
+	}
+}
+
+// startWildcardChecks starts wildcard detection for every level a name
+// could inherit a wildcard from, from its registrable domain down to its
+// immediate parent: x.b.example.co.uk checks example.co.uk and
+// b.example.co.uk, never co.uk.
+func (d *DNSEnumerator) startWildcardChecks(domain string) {
+	for _, parent := range wildcardParents(domain) {
+		d.startWildcardCheck(parent)
+	}
+}
+
+// startWildcardCheck runs DetectWildcard for base in the background, once
+// per base, so resolution of names under it can start right away. Probes
+// take their slot from the same -concurrency budget as the workers; when
+// none is free the caller waits, which keeps input with many distinct bases
+// from piling up goroutines.
+func (d *DNSEnumerator) startWildcardCheck(base string) {
+	if !d.Config.WildcardCheck || d.Config.DryRun {
+		return
+	}
+
+	base = dns.CanonicalName(base)
+	d.mutex.Lock()
+	if _, started := d.checkedWildcards[base]; started {
+		d.mutex.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	d.checkedWildcards[base] = done
+	d.mutex.Unlock()
+
+	d.slots <- struct{}{}
+	go func() {
+		defer func() {
+			<-d.slots
+			close(done)
+		}()
+		d.DetectWildcard(base)
+	}()
+}
+
+// awaitWildcard blocks until wildcard detection has finished for every base
+// domain that domain falls under, so the filter decision sees complete data
+func (d *DNSEnumerator) awaitWildcard(domain string) {
+	for _, parent := range ancestors(domain) {
+		d.mutex.Lock()
+		done, ok := d.checkedWildcards[parent]
+		d.mutex.Unlock()
+		if ok {
+			<-done
+		}
+	}
+}
+
+// ancestors returns the canonical names of every proper ancestor of domain,
+// nearest first: a.b.example.com gives b.example.com., example.com., com.
+func ancestors(domain string) []string {
+	labels := dns.SplitDomainName(domain)
+	var parents []string
+	for i := 1; i < len(labels); i++ {
+		parents = append(parents, dns.CanonicalName(strings.Join(labels[i:], ".")))
+	}
+	return parents
+}
+
+// wildcardParents returns the levels wildcard detection probes for domain:
+// its ancestors up to and including the registrable domain per the public
+// suffix list
+func wildcardParents(domain string) []string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return nil
+	}
+
+	var parents []string
+	for _, parent := range ancestors(domain) {
+		parents = append(parents, parent)
+		if parent == dns.CanonicalName(registrable) {
+			return parents
+		}
+	}
+	return nil // domain is itself the registrable domain, or a public suffix
+}
+
+// validName reports whether a generated name fits within -max-name-length
+func (d *DNSEnumerator) validName(name string) bool {
+	if length := len(strings.TrimSuffix(name, ".")); length > d.Config.MaxNameLength {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %d bytes exceeds the %d byte name limit\n", name, length, d.Config.MaxNameLength)
+		}
+		return false
+	}
+	return true
+}
+
+// randomLabel returns a label derived from the run seed that is unique within the run
+func (d *DNSEnumerator) randomLabel() string {
+	n := atomic.AddUint64(&d.labelCounter, 1)
+	return fmt.Sprintf("dnsaq-%08x-%d", d.labelSeed, n)
+}
+
+// isWildcardResponse reports whether any of ips came from a wildcard that
+// domain falls under, or is one of the -wildcard-ips
+func (d *DNSEnumerator) isWildcardResponse(domain string, ips []string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, ip := range ips {
+		if d.wildcardIPs[ip] {
+			return true
+		}
+	}
+	for _, parent := range ancestors(domain) {
+		if answers := d.wildcardAnswers[parent]; answers != nil {
+			for _, ip := range ips {
+				if answers[ip] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchesFreshProbe implements -wildcard-strict: it queries a random
+// sibling of domain and reports whether it gets exactly the same records.
+// This catches wildcards that rotate through an IP pool or alias to a load
+// balancer, which the probe-time IP set alone misses.
+func (d *DNSEnumerator) matchesFreshProbe(domain string, qtype uint16, flags QueryFlags, records []string) bool {
+	if !d.Config.WildcardStrict || !d.Config.WildcardCheck || len(records) == 0 {
+		return false
+	}
+
+	parents := ancestors(domain)
+	if len(parents) == 0 {
+		return false
+	}
+	probe := d.randomLabel() + "." + parents[0]
+	if !d.validName(probe) {
+		return false
+	}
+
+	d.wait()
+	answer, err := d.lookupQuery(probe, qtype, flags)
+	if err != nil {
+		return false
+	}
+	return sameRecords(records, answer.Records)
+}
+
+// sameRecords reports whether a and b hold the same records in any order
+func sameRecords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, record := range a {
+		counts[record]++
+	}
+	for _, record := range b {
+		if counts[record] == 0 {
+			return false
+		}
+		counts[record]--
+	}
+	return true
+}
+
+// lookupQuery looks up domain the way ProcessQuery reports it: A lookups
+// include AAAA addresses under -6
+func (d *DNSEnumerator) lookupQuery(domain string, qtype uint16, flags QueryFlags) (*Answer, error) {
+	if qtype == dns.TypeA && d.Config.IPv6 {
+		return d.lookupAddresses(domain, flags)
+	}
+	return d.LookupWithFlags(domain, qtype, flags)
+}
+
+// ProcessDomain resolves a domain and sends results to the channel
+func (d *DNSEnumerator) ProcessDomain(domain string, results chan<- Result) {
+	if d.dryRun(domain) {
+		return
+	}
+	if d.Config.PTR {
+		d.processPTR(domain, results)
+		return
+	}
+	if d.Config.Discover {
+		d.processDiscover(domain, results)
+		return
+	}
+	if d.Config.MX {
+		d.processMX(domain, results)
+		return
+	}
+	if d.Config.SPF {
+		d.processSPF(domain, results)
+		return
+	}
+	if d.Config.SRV {
+		d.processSRV(domain, results)
+		return
+	}
+	if d.Config.CompareResolvers {
+		d.processCompare(domain, results)
+		return
+	}
+	if types := d.queryTypes(); len(types) > 1 {
+		d.processTypes(domain, types, results)
+		return
+	}
+	d.ProcessQuery(domain, d.Config.QueryType, QueryFlags{}, results)
+}
+
+// queryTypes returns the record types queried for every name. QueryType
+// stands in when no list was configured.
+func (d *DNSEnumerator) queryTypes() []uint16 {
+	if len(d.Config.QueryTypes) > 0 {
+		return d.Config.QueryTypes
+	}
+	return []uint16{d.Config.QueryType}
+}
+
+// ProcessQuery resolves a domain with an explicit type and header flags and
+// sends results to the channel
+func (d *DNSEnumerator) ProcessQuery(domain string, qtype uint16, flags QueryFlags, results chan<- Result) {
+	if d.processQuery(domain, qtype, flags, results) {
+		atomic.AddInt64(&d.stats.Resolved, 1)
+	}
+}
+
+// processQuery does the work of ProcessQuery, reporting whether the name
+// resolved so callers querying several types can count it once
+func (d *DNSEnumerator) processQuery(domain string, qtype uint16, flags QueryFlags, results chan<- Result) bool {
+	if d.dryRun(domain) {
+		return false
+	}
+	answer, err := d.lookupQuery(domain, qtype, flags)
+	if err != nil {
+		if isNXDomain(err) {
+			atomic.AddInt64(&d.stats.NXDomain, 1)
+			if d.Config.ShowNXDomain {
+				d.sendResult(results, Result{
+					Domain:    domain,
+					Type:      dns.TypeToString[qtype],
+					Status:    dns.RcodeToString[dns.RcodeNameError],
+					Timestamp: time.Now().UTC(),
+				})
+			}
+		} else if !d.stopped() {
+			d.sendResult(results, Result{
+				Domain:    domain,
+				Type:      dns.TypeToString[qtype],
+				Status:    statusError,
+				Error:     err.Error(),
+				Timestamp: time.Now().UTC(),
+			})
+		}
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", domain, err)
+		}
+		return false
+	}
+
+	chain := cnameChain(dns.Fqdn(domain), answer.RRs)
+	if answer.Dangling {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Dangling CNAME %s -> %s\n", domain, strings.Join(chain, " -> "))
+		}
+		result := Result{
+			Domain:    domain,
+			Type:      dns.TypeToString[qtype],
+			CNAMEs:    chain,
+			Dangling:  true,
+			Resolver:  answer.Resolver,
+			RTT:       milliseconds(answer.RTT),
+			Timestamp: time.Now().UTC(),
+		}
+		if d.Config.Takeover {
+			result.Takeover = d.checkTakeover(domain, chain, nil, true)
+		}
+		d.sendResult(results, result)
+		return false
+	}
+
+	// Names that exist without the queried type go to their own stream for re-querying
+	if answer.NoData && d.noDataFile != nil {
+		d.writeNoData(domain)
+		return false
+	}
+
+	// A name that exists without the queried type is not a miss, but it is
+	// not a result either unless -show-empty asks for it. Aliases are kept,
+	// since the chain itself is worth reporting.
+	if answer.NoData && len(chain) == 0 {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "%s exists but has no %s records (NODATA)\n", domain, dns.TypeToString[qtype])
+		}
+		if !d.Config.ShowEmpty {
+			return false
+		}
+	}
+
+	// Skip wildcard responses, whether detected or seeded via -wildcard-ips
+	d.awaitWildcard(domain)
+	if d.isWildcardResponse(domain, answer.Records) || d.matchesFreshProbe(domain, qtype, flags, answer.Records) {
+		atomic.AddInt64(&d.stats.WildcardFiltered, 1)
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Filtered wildcard response for %s: %v\n", domain, answer.Records)
+		}
+		if d.Config.AllResults {
+			d.sendResult(results, Result{
+				Domain:    domain,
+				Type:      dns.TypeToString[qtype],
+				Status:    statusWildcard,
+				Resolver:  answer.Resolver,
+				Timestamp: time.Now().UTC(),
+			})
+		}
+		return false
+	}
+
+	result := Result{
+		Domain:    domain,
+		Type:      dns.TypeToString[qtype],
+		Records:   d.capAnswers(answer.Records),
+		CNAMEs:    chain,
+		Resolver:  answer.Resolver,
+		RTT:       milliseconds(answer.RTT),
+		Timestamp: time.Now().UTC(),
+	}
+	if answer.NoData {
+		result.Status = statusNoData
+	}
+	if d.Config.FlagPrivate && containsIP(privateNetworks, answer.Records) {
+		result.Private = true
+	}
+	if d.Config.Takeover && len(chain) > 0 {
+		result.Takeover = d.checkTakeover(domain, chain, answer.Records, false)
+	}
+	if d.Config.Raw {
+		for _, rr := range answer.RRs {
+			result.Raw = append(result.Raw, rr.String())
+		}
+	}
+	d.sendResult(results, result)
+	return len(answer.Records) > 0
+}
+
+// EnumerateFromReader processes domains from a reader (stdin or file) until
+// the input ends or ctx is cancelled
+func (d *DNSEnumerator) EnumerateFromReader(ctx context.Context, reader *bufio.Reader) {
+	defer d.stopWith(ctx)()
+
+	results := d.newResults()
+	written := make(chan struct{})
+
+	// Process results
+	go d.writeResults(results, written)
+	stopProgress := d.startProgress()
+
+	pool := d.newWorkerPool()
+	scanner := newLineReader(reader)
+	for scanner.Scan() {
+		domain := scanner.Text()
+
+		// In -ptr mode a CIDR line stands for every host address in the range
+		if d.Config.PTR && strings.Contains(domain, "/") {
+			if !d.enumerateCIDR(domain, pool, results) {
+				break
+			}
+			continue
+		}
+
+		qtype, flags := d.Config.QueryType, QueryFlags{}
+		if d.Config.ParseFlags {
+			var err error
+			if domain, qtype, flags, err = ParseAnnotatedLine(domain, qtype); err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %q: %v\n", scanner.Text(), err)
+				continue
+			}
+		}
+
+		host, ok := normalizeDomain(domain)
+		if !ok {
+			scanner.Skipped++
+			continue
+		}
+
+		// Internationalized names are queried in their A-label form
+		ascii, err := asciiName(host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %q: %v\n", scanner.Text(), err)
+			continue
+		}
+		domain = ascii
+
+		// Probe the base domain for wildcards alongside resolution instead of
+		// stalling the pipeline; ProcessDomain waits for it before filtering
+		if !d.Config.PTR {
+			d.startWildcardChecks(domain)
+		}
+
+		if d.stopped() {
+			break
+		}
+		if d.alreadyDone(domain) {
+			continue
+		}
+		d.wait()
+		pool.Submit(func() {
+			if d.Config.ParseFlags && !d.Config.Discover && !d.Config.PTR {
+				d.ProcessQuery(domain, qtype, flags, results)
+			} else {
+				d.ProcessDomain(domain, results)
+			}
+			d.markDone(domain)
+		})
+	}
+
+	pool.Wait()
+	close(results)
+	<-written
+	stopProgress()
+	d.reportRun()
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+	}
+	if scanner.Skipped > 0 && d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Skipped %d malformed input lines\n", scanner.Skipped)
+	}
+}
+
+// Bruteforce performs subdomain brute-forcing until the wordlist ends or ctx
+// is cancelled
+func (d *DNSEnumerator) Bruteforce(ctx context.Context, domain string, wordlistPath string) {
+	d.BruteforceDomains(ctx, []string{domain}, wordlistPath)
+}
+
+// BruteforceDomains runs the wordlist against each base domain in turn until
+// it is exhausted or ctx is cancelled. The bases share the rate limiter and
+// -concurrency workers, so both stay global caps, while wildcards are
+// detected per base. With -recursive, the names found at one level become
+// the bases of the next, down to -depth levels.
+func (d *DNSEnumerator) BruteforceDomains(ctx context.Context, domains []string, wordlistPath string) {
+	defer d.stopWith(ctx)()
+
+	file, err := openInput(wordlistPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening wordlist: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	// Counting reads the whole wordlist, so only do it for the progress total
+	var words int64
+	if d.showProgress() {
+		words = countLines(file)
+	}
+
+	// The wordlist streams from disk unless -shuffle needs it all at once
+	var wordlist io.ReadSeeker = file
+	if d.Config.Shuffle {
+		seed := d.Config.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+			return
+		}
+		shuffled, err := shuffleLines(file, seed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+			return
+		}
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Shuffled %d words with -seed %d\n", words, seed)
+		}
+		wordlist = shuffled
+	}
+
+	results := d.newResults()
+	written := make(chan struct{})
+
+	// Process results
+	go d.writeResults(results, written)
+	stopProgress := d.startProgress()
+
+	var valid []string
+	for _, domain := range domains {
+		host, ok := normalizeDomain(domain)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Skipping base domain %q: not a host name\n", domain)
+			continue
+		}
+		ascii, err := asciiName(host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping base domain %q: %v\n", domain, err)
+			continue
+		}
+		valid = append(valid, ascii)
+	}
+	domains = valid
+
+	levels := 1
+	if d.Config.Recursive {
+		levels = d.Config.Depth
+	}
+	bases := make(map[string]bool)
+	for _, domain := range domains {
+		bases[dns.CanonicalName(domain)] = true
+	}
+
+	for level := 1; level <= levels && len(domains) > 0 && !d.stopped(); level++ {
+		if level > 1 && d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Recursing into %d bases at depth %d\n", len(domains), level)
+		}
+		atomic.AddInt64(&d.progressTotal, words*int64(len(domains)))
+		found := d.bruteforceLevel(domains, wordlist, results, level == 1)
+
+		// Each name is brute-forced as a base at most once, however many
+		// levels or record types find it
+		domains = nil
+		for _, name := range found {
+			if key := dns.CanonicalName(name); !bases[key] {
+				bases[key] = true
+				domains = append(domains, name)
+			}
+		}
+	}
+
+	close(results)
+	<-written
+	stopProgress()
+	d.reportRun()
+}
+
+// bruteforceLevel runs the wordlist against every base, forwarding results
+// and returning the names that resolved for use as deeper bases
+func (d *DNSEnumerator) bruteforceLevel(domains []string, wordlist io.ReadSeeker, results chan<- Result, reportSkipped bool) []string {
+	for _, domain := range domains {
+		d.startWildcardCheck(domain)
+	}
+
+	levelResults := d.newResults()
+	collected := make(chan struct{})
+	var found []string
+	go func() {
+		defer close(collected)
+		for result := range levelResults {
+			if d.Config.Recursive && len(result.Records) > 0 && result.Status == "" {
+				found = append(found, result.Domain)
+			}
+			results <- result
+		}
+	}()
+
+	pool := d.newWorkerPool()
+	for i, domain := range domains {
+		if _, err := wordlist.Seek(0, io.SeekStart); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+			break
+		}
+		// Malformed lines are the same on every pass; report them once
+		if !d.bruteforceDomain(domain, wordlist, pool, levelResults, reportSkipped && i == 0) {
+			break
+		}
+	}
+
+	pool.Wait()
+	close(levelResults)
+	<-collected
+	return found
+}
+
+// bruteforceDomain queues a lookup of every wordlist entry under domain. It
+// reports false once the run has been stopped or the wordlist can't be read.
+func (d *DNSEnumerator) bruteforceDomain(domain string, wordlist io.Reader, pool *workerPool, results chan<- Result, reportSkipped bool) bool {
+	scanner := newLineReader(wordlist)
+	for scanner.Scan() {
+		sub := scanner.Text()
+
+		fullDomain, err := asciiName(sub + "." + domain)
+		if err != nil {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Skipping %s.%s: %v\n", sub, domain, err)
+			}
+			continue
+		}
+		if !d.validName(fullDomain) {
+			continue
+		}
+		// Words with dots reach deeper levels that may have wildcards of their own
+		d.startWildcardChecks(fullDomain)
+		if d.stopped() {
+			return false
+		}
+		if d.alreadyDone(fullDomain) {
+			continue
+		}
+		d.wait()
+		pool.Submit(func() {
+			d.ProcessDomain(fullDomain, results)
+			d.markDone(fullDomain)
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+		return false
+	}
+	if scanner.Skipped > 0 && reportSkipped && d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Skipped %d malformed wordlist lines\n", scanner.Skipped)
+	}
+	return true
+}
+
+// LoadDomains collects the base domains given as a comma-separated -d list
+// and in a -dL file, dropping blanks and duplicates
+func LoadDomains(list, filename string) ([]string, error) {
+	var entries []string
+	if list != "" {
+		entries = strings.Split(list, ",")
+	}
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := newLineReader(file)
+		for scanner.Scan() {
+			entries = append(entries, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	var domains []string
+	for _, domain := range entries {
+		domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+		if domain != "" && !seen[strings.ToLower(domain)] {
+			seen[strings.ToLower(domain)] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
@@ -0,0 +1,581 @@
+package dnsaq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolve(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"www.example.test. A":   {"www.example.test. 60 IN A 192.0.2.1", "www.example.test. 60 IN A 192.0.2.2"},
+		"mail.example.test. MX": {"mail.example.test. 60 IN MX 10 mx.example.test."},
+		"txt.example.test. TXT": {`txt.example.test. 60 IN TXT "hello world"`},
+	}))
+	d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+	records, err := d.Resolve("www.example.test")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Resolve = %v, want %v", records, want)
+	}
+
+	records, err = d.ResolveType("mail.example.test", dns.TypeMX)
+	if err != nil {
+		t.Fatalf("ResolveType MX: %v", err)
+	}
+	if want := []string{"10 mx.example.test."}; !reflect.DeepEqual(records, want) {
+		t.Errorf("ResolveType MX = %v, want %v", records, want)
+	}
+
+	answer, err := d.Lookup("txt.example.test", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("Lookup TXT: %v", err)
+	}
+	if len(answer.Records) != 1 || answer.Resolver != server.Addr {
+		t.Errorf("Lookup TXT = %v from %s, want one record from %s", answer.Records, answer.Resolver, server.Addr)
+	}
+}
+
+func TestResolveNoData(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"v6only.example.test. AAAA": {"v6only.example.test. 60 IN AAAA 2001:db8::1"},
+	}))
+	d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+	answer, err := d.Lookup("v6only.example.test", dns.TypeA)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if !answer.NoData || len(answer.Records) != 0 {
+		t.Errorf("Lookup = %+v, want NODATA without records", answer)
+	}
+}
+
+func TestResolveRcodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		rcode int
+		// queries is how many times the single resolver is asked; rcodes
+		// that blame the resolver get another pass with -retries
+		queries int
+	}{
+		{"NXDOMAIN", dns.RcodeNameError, 1},
+		{"SERVFAIL", dns.RcodeServerFailure, 2},
+		{"REFUSED", dns.RcodeRefused, 2},
+		{"NOTIMP", dns.RcodeNotImplemented, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockServer(t, rcodeHandler(tt.rcode))
+			d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+				config.Retries = 1
+			})
+
+			_, err := d.Resolve("name.example.test")
+			var dnsErr *DNSError
+			if !errors.As(err, &dnsErr) {
+				t.Fatalf("Resolve error = %v, want a DNSError", err)
+			}
+			if dnsErr.Rcode != tt.rcode || dnsErr.Resolver != server.Addr {
+				t.Errorf("DNSError = %s from %s, want %s from %s", dns.RcodeToString[dnsErr.Rcode], dnsErr.Resolver, tt.name, server.Addr)
+			}
+			if got := isNXDomain(err); got != (tt.rcode == dns.RcodeNameError) {
+				t.Errorf("isNXDomain = %v", got)
+			}
+			if got := len(server.Queries()); got != tt.queries {
+				t.Errorf("resolver got %d queries, want %d", got, tt.queries)
+			}
+		})
+	}
+}
+
+func TestResolveUnreachable(t *testing.T) {
+	// A port that was just freed has nothing listening, so UDP is refused
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	d := newTestEnumerator(t, []string{addr}, nil)
+
+	if _, err := d.Resolve("name.example.test"); !errors.Is(err, errAllResolversFailed) {
+		t.Errorf("Resolve error = %v, want errAllResolversFailed", err)
+	}
+}
+
+func TestFailedLookupsCountRcodeFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(string, dns.ResponseWriter, *dns.Msg)
+		failed  int64
+	}{
+		{"refused", rcodeHandler(dns.RcodeRefused), 1},
+		{"servfail", rcodeHandler(dns.RcodeServerFailure), 1},
+		{"nxdomain", rcodeHandler(dns.RcodeNameError), 0},
+		{"answer", zoneHandler(map[string][]string{"name.example.test. A": {"name.example.test. 60 IN A 192.0.2.1"}}), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockServer(t, tt.handler)
+			d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+			d.Resolve("name.example.test")
+			stats := d.stats.Snapshot()
+			if stats.Lookups != 1 || stats.FailedLookups != tt.failed {
+				t.Errorf("Lookups = %d, FailedLookups = %d, want 1 and %d", stats.Lookups, stats.FailedLookups, tt.failed)
+			}
+			if healthy := tt.failed == 0; d.Healthy() != healthy {
+				t.Errorf("Healthy() = %v, want %v", d.Healthy(), healthy)
+			}
+		})
+	}
+}
+
+func TestDetectWildcard(t *testing.T) {
+	server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		name := strings.ToLower(r.Question[0].Name)
+		switch {
+		case name == "real.wild.test.":
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.10")
+			m.Answer = append(m.Answer, rr)
+		case strings.HasSuffix(name, ".wild.test."):
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.99")
+			m.Answer = append(m.Answer, rr)
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.WildcardCheck = true
+	})
+
+	d.DetectWildcard("wild.test.")
+	d.DetectWildcard("tame.test.")
+
+	if !d.isWildcardResponse("anything.wild.test", []string{"192.0.2.99"}) {
+		t.Error("answer matching the wildcard probes was not filtered")
+	}
+	if d.isWildcardResponse("real.wild.test", []string{"192.0.2.10"}) {
+		t.Error("answer differing from the wildcard probes was filtered")
+	}
+	if d.isWildcardResponse("anything.tame.test", []string{"192.0.2.99"}) {
+		t.Error("a wildcard under wild.test filtered a name under tame.test")
+	}
+}
+
+func TestWildcardChecksBoundedByConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	var inFlight, peak int
+	server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		mutex.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.WildcardCheck = true
+		config.Concurrency = 3
+	})
+
+	// Every name starts probes of a new base while the workers resolve the
+	// names before it, so queries in flight count probes and lookups together
+	var input strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&input, "host.base%d.example.test\n", i)
+	}
+	d.EnumerateFromReader(context.Background(), bufio.NewReader(strings.NewReader(input.String())))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if peak > 3 {
+		t.Errorf("%d probes and lookups ran at once, want at most -concurrency 3", peak)
+	}
+	// Probes still running when the last lookup finishes are cut short, so
+	// only the lookups are counted exactly
+	lookups := 0
+	for _, query := range server.Queries() {
+		if strings.HasPrefix(query.Question.Name, "host.") {
+			lookups++
+		}
+	}
+	if lookups != 30 {
+		t.Errorf("resolver got %d lookups, want 30", lookups)
+	}
+}
+
+func TestResolveTruncatedAnswerRetriedOverTCP(t *testing.T) {
+	server := newMockServer(t, func(network string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+		m.Answer = append(m.Answer, rr)
+		if network == "udp" {
+			m.Truncated = true
+		} else {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.2")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+	records, err := d.Resolve("big.example.test")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Resolve = %v, want the TCP answer %v", records, want)
+	}
+	if udp, tcp := server.QueriesOver("udp"), server.QueriesOver("tcp"); udp != 1 || tcp != 1 {
+		t.Errorf("got %d UDP and %d TCP queries, want 1 of each", udp, tcp)
+	}
+}
+
+func TestResolveLargeAnswerOverTCP(t *testing.T) {
+	// 60 addresses need about 1KB, twice what fits in a classic UDP answer
+	tests := []struct {
+		protocol string
+		// full is whether all 60 addresses come back; tcp is how many
+		// queries go over TCP
+		full bool
+		tcp  int
+	}{
+		{ProtocolAuto, true, 1},
+		{ProtocolUDP, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			server := newMockServer(t, largeAnswerHandler(60))
+			d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+				config.Protocol = tt.protocol
+			})
+
+			answer, err := d.Lookup("big.example.test", dns.TypeA)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if full := len(answer.Records) == 60; full != tt.full {
+				t.Errorf("Lookup returned %d of 60 records", len(answer.Records))
+			}
+			if got := server.QueriesOver("tcp"); got != tt.tcp {
+				t.Errorf("got %d TCP queries, want %d", got, tt.tcp)
+			}
+		})
+	}
+}
+
+func TestResolveLargeAnswerWithEDNSBufferOverUDP(t *testing.T) {
+	server := newMockServer(t, largeAnswerHandler(60))
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.EDNSBufSize = 4096
+	})
+
+	answer, err := d.Lookup("big.example.test", dns.TypeA)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(answer.Records) != 60 {
+		t.Errorf("Lookup returned %d of 60 records", len(answer.Records))
+	}
+	if udp, tcp := server.QueriesOver("udp"), server.QueriesOver("tcp"); udp != 1 || tcp != 0 {
+		t.Errorf("got %d UDP and %d TCP queries, want the answer in one UDP query", udp, tcp)
+	}
+	if opt := server.Queries()[0].Msg.IsEdns0(); opt == nil || opt.UDPSize() != 4096 {
+		t.Errorf("query OPT record = %v, want a 4096-byte buffer", opt)
+	}
+}
+
+func TestResolveFallsBackToNextResolver(t *testing.T) {
+	// A closed port fails to connect; SERVFAIL answers but blames the resolver,
+	// as does FORMERR to an EDNS query when the plain retry goes unanswered
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := conn.LocalAddr().String()
+	conn.Close()
+
+	tests := []struct {
+		name    string
+		first   func(t *testing.T) (string, *mockServer)
+		queries int
+	}{
+		{"unreachable", func(*testing.T) (string, *mockServer) { return closed, nil }, 0},
+		{"SERVFAIL", func(t *testing.T) (string, *mockServer) {
+			server := newMockServer(t, rcodeHandler(dns.RcodeServerFailure))
+			return server.Addr, server
+		}, 1},
+		{"FORMERR", func(t *testing.T) (string, *mockServer) {
+			server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+				if r.IsEdns0() != nil {
+					m := new(dns.Msg)
+					m.SetRcode(r, dns.RcodeFormatError)
+					w.WriteMsg(m)
+				}
+			})
+			return server.Addr, server
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			firstAddr, first := tt.first(t)
+			second := newMockServer(t, zoneHandler(map[string][]string{
+				"www.example.test. A": {"www.example.test. 60 IN A 192.0.2.1"},
+			}))
+			d := newTestEnumerator(t, []string{firstAddr, second.Addr}, func(config *DNSConfig) {
+				config.ResolverStrategy = StrategyOrdered
+				config.EDNSBufSize = 1232
+				config.Timeout = 200 * time.Millisecond
+			})
+
+			answer, err := d.Lookup("www.example.test", dns.TypeA)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if answer.Resolver != second.Addr || !reflect.DeepEqual(answer.Records, []string{"192.0.2.1"}) {
+				t.Errorf("Lookup = %v from %s, want 192.0.2.1 from the second resolver %s", answer.Records, answer.Resolver, second.Addr)
+			}
+			if first != nil && len(first.Queries()) != tt.queries {
+				t.Errorf("first resolver got %d queries, want %d", len(first.Queries()), tt.queries)
+			}
+			if got := len(second.Queries()); got != 1 {
+				t.Errorf("second resolver got %d queries, want 1", got)
+			}
+		})
+	}
+}
+
+func TestResolveStopsAtFirstSuccess(t *testing.T) {
+	zone := map[string][]string{
+		"www.example.test. A": {"www.example.test. 60 IN A 192.0.2.1"},
+	}
+	first := newMockServer(t, zoneHandler(zone))
+	second := newMockServer(t, zoneHandler(zone))
+	d := newTestEnumerator(t, []string{first.Addr, second.Addr}, func(config *DNSConfig) {
+		config.ResolverStrategy = StrategyOrdered
+	})
+
+	// NXDOMAIN is an answer too, so it must not fall through either
+	for _, name := range []string{"www.example.test", "missing.example.test"} {
+		answer, err := d.Lookup(name, dns.TypeA)
+		if err == nil && answer.Resolver != first.Addr {
+			t.Errorf("%s answered by %s, want the first resolver %s", name, answer.Resolver, first.Addr)
+		}
+	}
+	if got := len(first.Queries()); got != 2 {
+		t.Errorf("first resolver got %d queries, want 2", got)
+	}
+	if got := len(second.Queries()); got != 0 {
+		t.Errorf("second resolver got %d queries after the first one answered", got)
+	}
+}
+
+func FuzzLoadResolvers(f *testing.F) {
+	f.Add("1.1.1.1\n# comment\n8.8.8.8:53\n")
+	f.Add("tier:2 9.9.9.9\ntier:1 [2001:db8::1]:5353\n")
+	f.Add("tls://dns.example:853\nhttps://dns.example/dns-query\n")
+	f.Add("tier:0 1.1.1.1\n1.1.1.1:99999\nftp://x\n")
+
+	// Host names resolve without touching the network
+	lookup := lookupHost
+	lookupHost = func(host string) ([]string, error) { return []string{"192.0.2.53"}, nil }
+	f.Cleanup(func() { lookupHost = lookup })
+
+	f.Fuzz(func(t *testing.T, data string) {
+		path := filepath.Join(t.TempDir(), "resolvers.txt")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		resolvers, tiers, _, err := loadResolvers(path)
+		if err != nil {
+			t.Fatalf("loadResolvers: %v", err)
+		}
+		if len(tiers) != len(resolvers) {
+			t.Fatalf("%d tiers for %d resolvers", len(tiers), len(resolvers))
+		}
+		for _, resolver := range resolvers {
+			if tiers[resolver] < 1 {
+				t.Fatalf("resolver %q has tier %d", resolver, tiers[resolver])
+			}
+			// Loaded entries are normalized already
+			if again, err := NormalizeResolver(resolver); err != nil || again != resolver {
+				t.Fatalf("NormalizeResolver(%q) = %q, %v", resolver, again, err)
+			}
+		}
+	})
+}
+
+func TestRunStopsAtDeadline(t *testing.T) {
+	// Every answer takes 100ms, so 1000 names at -concurrency 5 take 20s
+	const delay = 100 * time.Millisecond
+	answer := zoneHandler(nil)
+	server := newMockServer(t, func(network string, w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(delay)
+		answer(network, w, r)
+	})
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.Concurrency = 5
+	})
+
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "host%d.example.test\n", i)
+	}
+
+	// -max-time is a deadline on the run's context
+	const maxTime = 300 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), maxTime)
+	defer cancel()
+	start := time.Now()
+	d.EnumerateFromReader(ctx, bufio.NewReader(strings.NewReader(input.String())))
+	elapsed := time.Since(start)
+
+	// Lookups in flight at the deadline still get their answers
+	if margin := 2*delay + 100*time.Millisecond; elapsed > maxTime+margin {
+		t.Errorf("run took %v, want it to stop within %v of the %v deadline", elapsed, margin, maxTime)
+	}
+	if processed := d.Processed(); processed == 0 || processed >= 1000 {
+		t.Errorf("%d names processed, want some but not all of them", processed)
+	}
+}
+
+func TestOneShotModesStopWhenCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(d *DNSEnumerator, ctx context.Context)
+	}{
+		{"axfr", func(d *DNSEnumerator, ctx context.Context) { d.AttemptAXFR(ctx, "example.test") }},
+		{"audit", func(d *DNSEnumerator, ctx context.Context) { d.AuditResolvers(ctx, "example.test") }},
+		{"bench", func(d *DNSEnumerator, ctx context.Context) { d.BenchmarkResolvers(ctx, "example.test", 10, false) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first query cancels the run, as a SIGINT would
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			answer := zoneHandler(map[string][]string{
+				"example.test. NS": {"example.test. 60 IN NS ns1.example.test.", "example.test. 60 IN NS ns2.example.test."},
+			})
+			first := newMockServer(t, func(network string, w dns.ResponseWriter, r *dns.Msg) {
+				cancel()
+				answer(network, w, r)
+			})
+			second := newMockServer(t, answer)
+			d := newTestEnumerator(t, []string{first.Addr, second.Addr}, nil)
+
+			tt.run(d, ctx)
+
+			if got := len(first.Queries()); got != 1 {
+				t.Errorf("first resolver got %d queries, want 1", got)
+			}
+			if got := len(second.Queries()); got != 0 {
+				t.Errorf("second resolver got %d queries after cancellation, want 0", got)
+			}
+		})
+	}
+}
+
+func TestChaosVersionBind(t *testing.T) {
+	// Only a CHAOS question gets the version; IN gets REFUSED, as BIND does
+	server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		q := r.Question[0]
+		if q.Qclass != dns.ClassCHAOS || q.Qtype != dns.TypeTXT || !strings.EqualFold(q.Name, "version.bind.") {
+			m.SetRcode(r, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+		m.SetReply(r)
+		rr, _ := dns.NewRR(q.Name + ` 0 CH TXT "9.18.24"`)
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+	var stdout bytes.Buffer
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.QueryType = dns.TypeTXT
+		config.QueryTypes = []uint16{dns.TypeTXT}
+		config.QueryClass = dns.ClassCHAOS
+		config.StdoutFormat = FormatJSON
+		config.Stdout = &stdout
+	})
+
+	d.EnumerateFromReader(context.Background(), bufio.NewReader(strings.NewReader("version.bind\n")))
+	d.Close()
+
+	queries := server.Queries()
+	if len(queries) != 1 || queries[0].Question.Qclass != dns.ClassCHAOS {
+		t.Fatalf("queries = %+v, want one CHAOS question", queries)
+	}
+	var result Result
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("decoding %q: %v", stdout.String(), err)
+	}
+	if result.Domain != "version.bind" || result.Class != "CH" || !reflect.DeepEqual(result.Records, []string{"9.18.24"}) {
+		t.Errorf("result = %+v, want version.bind CH with the version TXT", result)
+	}
+}
+
+func TestNewDNSEnumeratorFillsDefaults(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"www.example.test. A": {"www.example.test. 60 IN A 192.0.2.1"},
+	}))
+	// Only what a library caller has to say: where to send queries
+	config := &DNSConfig{Resolvers: []string{server.Addr}, WildcardCheck: true}
+	d, err := NewDNSEnumerator(config)
+	if err != nil {
+		t.Fatalf("NewDNSEnumerator: %v", err)
+	}
+	defer d.Close()
+
+	if config.Timeout != DefaultTimeout || config.MaxNameLength != MaxNameLength || config.QueryType != dns.TypeA {
+		t.Errorf("defaults = %v, %d, %s; want %v, %d, A", config.Timeout, config.MaxNameLength, dns.TypeToString[config.QueryType], DefaultTimeout, MaxNameLength)
+	}
+
+	results := d.ResolveNames(context.Background(), []string{"www.example.test"})
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Records, []string{"192.0.2.1"}) {
+		t.Fatalf("ResolveNames = %+v, want the A record of www.example.test", results)
+	}
+	// The wildcard probes pass validName, and every query asks for A records
+	probes := 0
+	for _, query := range server.Queries() {
+		if query.Question.Qtype != dns.TypeA {
+			t.Errorf("query for %s asked for type %s, want A", query.Question.Name, dns.TypeToString[query.Question.Qtype])
+		}
+		if query.Question.Name != "www.example.test." {
+			probes++
+		}
+	}
+	if probes == 0 {
+		t.Error("no wildcard probes were sent")
+	}
+}
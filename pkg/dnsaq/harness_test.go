@@ -0,0 +1,190 @@
+package dnsaq
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// mockServer is an in-process DNS server on 127.0.0.1, answering over UDP
+// and TCP on the same port with a handler set by the test. It records every
+// query it receives.
+type mockServer struct {
+	Addr string
+
+	mutex   sync.Mutex
+	queries []mockQuery
+}
+
+// mockQuery is one query received by a mockServer
+type mockQuery struct {
+	Net      string
+	Question dns.Question
+	Msg      *dns.Msg
+}
+
+// newMockServer starts a server answering with handler and stops it when the
+// test ends. The handler is given the network the query came in on.
+func newMockServer(t testing.TB, handler func(network string, w dns.ResponseWriter, r *dns.Msg)) *mockServer {
+	t.Helper()
+	server := &mockServer{}
+
+	// UDP gets a free port first, then TCP has to take the same one; another
+	// process may hold it over TCP, so try a few times
+	var udp net.PacketConn
+	var tcp net.Listener
+	for attempt := 0; attempt < 10 && tcp == nil; attempt++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listening on UDP: %v", err)
+		}
+		listener, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		udp, tcp = conn, listener
+	}
+	if tcp == nil {
+		t.Fatal("no port free over both UDP and TCP")
+	}
+	server.Addr = udp.LocalAddr().String()
+
+	serve := func(network string) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			server.mutex.Lock()
+			server.queries = append(server.queries, mockQuery{Net: network, Question: r.Question[0], Msg: r.Copy()})
+			server.mutex.Unlock()
+			handler(network, w, r)
+		}
+	}
+
+	var started sync.WaitGroup
+	started.Add(2)
+	udpServer := &dns.Server{PacketConn: udp, Handler: serve("udp"), NotifyStartedFunc: started.Done}
+	tcpServer := &dns.Server{Listener: tcp, Handler: serve("tcp"), NotifyStartedFunc: started.Done}
+	go udpServer.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	started.Wait()
+
+	t.Cleanup(func() {
+		udpServer.Shutdown()
+		tcpServer.Shutdown()
+	})
+	return server
+}
+
+// Queries returns the queries received so far
+func (s *mockServer) Queries() []mockQuery {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]mockQuery(nil), s.queries...)
+}
+
+// QueriesOver counts the queries received over network
+func (s *mockServer) QueriesOver(network string) int {
+	n := 0
+	for _, query := range s.Queries() {
+		if query.Net == network {
+			n++
+		}
+	}
+	return n
+}
+
+// zoneHandler answers from a map of "name. TYPE" keys to records in zone
+// file syntax, NXDOMAIN for names it has no records for and NOERROR without
+// answers for other types of known names. Names are matched case-blind.
+func zoneHandler(zone map[string][]string) func(string, dns.ResponseWriter, *dns.Msg) {
+	names := make(map[string]bool)
+	for key := range zone {
+		name, _, _ := strings.Cut(key, " ")
+		names[strings.ToLower(name)] = true
+	}
+	return func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		name := strings.ToLower(q.Name)
+		for _, record := range zone[name+" "+dns.TypeToString[q.Qtype]] {
+			rr, err := dns.NewRR(record)
+			if err != nil {
+				panic(err)
+			}
+			// Answers carry the name as asked, as real servers do
+			rr.Header().Name = q.Name
+			m.Answer = append(m.Answer, rr)
+		}
+		if len(m.Answer) == 0 && !names[name] {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	}
+}
+
+// rcodeHandler answers every query with rcode and no records
+func rcodeHandler(rcode int) func(string, dns.ResponseWriter, *dns.Msg) {
+	return func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		w.WriteMsg(m)
+	}
+}
+
+// newTestEnumerator builds an enumerator querying resolvers, with defaults
+// suited to tests: short timeouts, no rate limit, no wildcard probing and
+// output discarded. configure may adjust the config before it is used.
+func newTestEnumerator(t testing.TB, resolvers []string, configure func(*DNSConfig)) *DNSEnumerator {
+	t.Helper()
+	config := &DNSConfig{
+		Resolvers:        resolvers,
+		Timeout:          time.Second,
+		QueryType:        dns.TypeA,
+		QueryTypes:       []uint16{dns.TypeA},
+		StdoutFormat:     FormatPlain,
+		Stdout:           io.Discard,
+		MaxNameLength:    253,
+		MaxFailureRate:   0.5,
+		Concurrency:      10,
+		ResolverStrategy: StrategyOrdered,
+	}
+	if configure != nil {
+		configure(config)
+	}
+	enumerator, err := NewDNSEnumerator(config)
+	if err != nil {
+		t.Fatalf("NewDNSEnumerator: %v", err)
+	}
+	t.Cleanup(enumerator.Close)
+	return enumerator
+}
+
+// largeAnswerHandler answers every A query with records addresses from
+// 192.0.2.0/24, about 16 bytes each. Over UDP the answer is cut to the
+// buffer size the query advertises, 512 bytes without EDNS, and marked
+// truncated, as real servers do.
+func largeAnswerHandler(records int) func(string, dns.ResponseWriter, *dns.Msg) {
+	return func(network string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for i := 0; i < records; i++ {
+			rr, _ := dns.NewRR(fmt.Sprintf("%s 60 IN A 192.0.2.%d", r.Question[0].Name, i+1))
+			m.Answer = append(m.Answer, rr)
+		}
+		if network == "udp" {
+			size := dns.MinMsgSize
+			if opt := r.IsEdns0(); opt != nil {
+				size = int(opt.UDPSize())
+				m.SetEdns0(opt.UDPSize(), false)
+			}
+			m.Truncate(size)
+		}
+		w.WriteMsg(m)
+	}
+}
@@ -0,0 +1,65 @@
+package dnsaq
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// labelSeparators maps the full stops IDNA treats as label separators
+// (UTS #46) to the ASCII dot
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// asciiName converts the non-ASCII labels of an internationalized name to
+// their A-label (punycode) form, e.g. 例え.テスト to xn--r8jz45g.xn--zckzah.
+// ASCII labels are left alone, so service labels such as _dmarc keep
+// working. Names are converted as they are read, before any query is built.
+func asciiName(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+
+	labels := strings.Split(labelSeparators.Replace(name), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid internationalized label %q: %v", label, err)
+		}
+		labels[i] = ascii
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// displayName renders the A-labels of name in Unicode for output. Labels
+// that don't decode are shown as they are.
+func displayName(name string) string {
+	if !strings.Contains(strings.ToLower(name), "xn--") {
+		return name
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		if unicode, err := idna.Display.ToUnicode(label); err == nil {
+			labels[i] = unicode
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// isASCII reports whether s holds only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package dnsaq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestASCIIName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"_dmarc.bücher.example", "_dmarc.xn--bcher-kva.example"},
+		// Ideographic full stops separate labels too
+		{"例え。テスト", "xn--r8jz45g.xn--zckzah"},
+	}
+	for _, tt := range tests {
+		got, err := asciiName(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("asciiName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if got, err := asciiName("bad\u200d.example"); err == nil {
+		t.Errorf("asciiName accepted a label with a bare joiner as %q", got)
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"xn--bcher-kva.example", "bücher.example"},
+		{"XN--BCHER-KVA.example.", "bücher.example."},
+		{"xn--r8jz45g.xn--zckzah", "例え.テスト"},
+		// A label that doesn't decode is shown as it is
+		{"xn--x.example", "xn--x.example"},
+	}
+	for _, tt := range tests {
+		if got := displayName(tt.name); got != tt.want {
+			t.Errorf("displayName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInternationalizedNames(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"xn--bcher-kva.example. A": {"xn--bcher-kva.example. 60 IN A 192.0.2.1"},
+		"www.xn--bcher-kva.example. A": {
+			"www.xn--bcher-kva.example. 60 IN CNAME xn--r8jz45g.xn--zckzah.",
+			"xn--r8jz45g.xn--zckzah. 60 IN A 192.0.2.2",
+		},
+	}))
+
+	for _, format := range []string{FormatPlain, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var stdout bytes.Buffer
+			d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+				config.StdoutFormat = format
+				config.Stdout = &stdout
+			})
+			before := len(server.Queries())
+
+			d.EnumerateFromReader(context.Background(), bufio.NewReader(strings.NewReader("bücher.example\nwww.bücher.example\n")))
+			d.Close()
+
+			// Queries go out as A-labels
+			for _, query := range server.Queries()[before:] {
+				if !isASCII(query.Question.Name) || !strings.Contains(query.Question.Name, "xn--bcher-kva") {
+					t.Errorf("query for %q, want the punycode name", query.Question.Name)
+				}
+			}
+
+			output := stdout.String()
+			if strings.Contains(output, "xn--") {
+				t.Errorf("output shows A-labels:\n%s", output)
+			}
+			if format == FormatPlain {
+				for _, want := range []string{"bücher.example", "www.bücher.example", "例え.テスト"} {
+					if !strings.Contains(output, want) {
+						t.Errorf("output lacks %q:\n%s", want, output)
+					}
+				}
+				return
+			}
+			domains := make(map[string]Result)
+			for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+				var result Result
+				if err := json.Unmarshal([]byte(line), &result); err != nil {
+					t.Fatalf("decoding %q: %v", line, err)
+				}
+				domains[result.Domain] = result
+			}
+			if _, ok := domains["bücher.example"]; !ok {
+				t.Errorf("JSON output lacks bücher.example:\n%s", output)
+			}
+			if www, ok := domains["www.bücher.example"]; !ok || len(www.CNAMEs) == 0 || www.CNAMEs[0] != "例え.テスト" {
+				t.Errorf("JSON output lacks www.bücher.example aliased to 例え.テスト:\n%s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package dnsaq
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// inputFile is a wordlist or resolver file opened for reading. Files named
+// .gz or starting with the gzip magic bytes are decompressed as they are
+// read, so large lists can stay compressed on disk.
+type inputFile struct {
+	file    *os.File
+	reader  io.Reader
+	gzipped bool
+}
+
+// openInput opens path for reading, decompressing it if it is gzipped
+func openInput(path string) (*inputFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	input := &inputFile{file: file}
+	if err := input.rewind(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return input, nil
+}
+
+// rewind goes back to the start of the file, restarting decompression
+func (f *inputFile) rewind() error {
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	magic := make([]byte, len(gzipMagic))
+	n, err := io.ReadFull(f.file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	f.gzipped = bytes.Equal(magic[:n], gzipMagic) || strings.HasSuffix(strings.ToLower(f.file.Name()), ".gz")
+	if !f.gzipped {
+		f.reader = f.file
+		return nil
+	}
+	decompressed, err := gzip.NewReader(f.file)
+	if err != nil {
+		return fmt.Errorf("%s is not valid gzip: %v", f.file.Name(), err)
+	}
+	f.reader = decompressed
+	return nil
+}
+
+func (f *inputFile) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
+
+// Seek repositions a plain file. A gzipped one can only be rewound to the
+// start, which is all the wordlist passes need.
+func (f *inputFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		return 0, f.rewind()
+	}
+	if f.gzipped {
+		return 0, errors.New("a gzipped file can only be read from the start")
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *inputFile) Close() error {
+	return f.file.Close()
+}
+
+// shuffleLines reads all of r and returns its lines in an order shuffled
+// by seed, so a -seed reproduces a -shuffle run. The whole wordlist is held
+// in memory.
+func shuffleLines(r io.Reader, seed int64) (*bytes.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	rand.New(rand.NewSource(seed)).Shuffle(len(lines), func(i, j int) {
+		lines[i], lines[j] = lines[j], lines[i]
+	})
+	return bytes.NewReader([]byte(strings.Join(lines, "\n"))), nil
+}
+
+// maxLineLength caps input lines. Nothing longer can be a valid name or
+// resolver, and bounding it keeps a single huge line from exhausting memory.
+const maxLineLength = 1024
+
+// lineReader reads trimmed, non-empty lines from resolver files, wordlists and
+// domain lists, skipping lines that are overlong, not valid UTF-8, or that
+// contain control characters such as NUL bytes
+type lineReader struct {
+	reader  *bufio.Reader
+	line    string
+	err     error
+	Skipped int
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReaderSize(r, maxLineLength)}
+}
+
+// Scan advances to the next usable line, returning false at EOF or on a read error
+func (l *lineReader) Scan() bool {
+	for {
+		raw, err := l.reader.ReadSlice('\n')
+		tooLong := false
+		for err == bufio.ErrBufferFull {
+			tooLong = true
+			raw, err = l.reader.ReadSlice('\n')
+		}
+
+		if err != nil && err != io.EOF {
+			l.err = err
+			return false
+		}
+		if len(raw) == 0 && err == io.EOF {
+			return false
+		}
+
+		line := strings.TrimSpace(string(raw))
+		switch {
+		case tooLong || !validLine(line):
+			l.Skipped++
+		case line != "":
+			l.line = line
+			return true
+		}
+
+		if err == io.EOF {
+			return false
+		}
+	}
+}
+
+// Text returns the line found by the last call to Scan
+func (l *lineReader) Text() string {
+	return l.line
+}
+
+// Err returns the first non-EOF error encountered while reading
+func (l *lineReader) Err() error {
+	return l.err
+}
+
+func validLine(line string) bool {
+	if !utf8.ValidString(line) {
+		return false
+	}
+	for _, r := range line {
+		if unicode.IsControl(r) && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeDomain extracts the host name from a line as other tools print
+// it, e.g. "https://user@API.example.com:8443/path?q" or "*.example.com.",
+// giving "api.example.com" and "example.com". IP addresses are kept, so
+// -ptr input passes through. It reports false for lines that hold no
+// usable host name.
+func normalizeDomain(line string) (string, bool) {
+	host := strings.TrimSpace(line)
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+
+	// Bracketed IPv6 literals and host:port; a bare IPv6 address has
+	// several colons and no port to strip
+	if strings.HasPrefix(host, "[") {
+		if end := strings.Index(host, "]"); end > 0 {
+			host = host[1:end]
+		}
+	} else if strings.Count(host, ":") == 1 {
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+	}
+	if net.ParseIP(host) != nil {
+		return host, true
+	}
+
+	host = strings.TrimPrefix(host, "*.")
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") || strings.Contains(host, "..") {
+		return "", false
+	}
+	for _, r := range host {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !strings.ContainsRune("-_.。．｡", r) {
+			return "", false
+		}
+	}
+	return host, true
+}
@@ -0,0 +1,124 @@
+package dnsaq
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func FuzzLineReader(f *testing.F) {
+	f.Add([]byte("www\nmail\r\n  api  \n\n"))
+	f.Add([]byte("no trailing newline"))
+	f.Add([]byte("nul\x00byte\n\xff\xfe\nok\n"))
+	f.Add([]byte(strings.Repeat("x", maxLineLength+10) + "\nafter\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		scanner := newLineReader(strings.NewReader(string(data)))
+		lines := 0
+		for scanner.Scan() {
+			line := scanner.Text()
+			lines++
+			if line == "" || line != strings.TrimSpace(line) {
+				t.Fatalf("line %q is empty or untrimmed", line)
+			}
+			if len(line) > maxLineLength || !utf8.ValidString(line) {
+				t.Fatalf("line %q is overlong or not UTF-8", line)
+			}
+			for _, r := range line {
+				if unicode.IsControl(r) && r != '\t' {
+					t.Fatalf("line %q holds control character %U", line, r)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("Err = %v reading from memory", err)
+		}
+		if total := strings.Count(string(data), "\n") + 1; lines+scanner.Skipped > total {
+			t.Fatalf("%d lines and %d skipped out of %d", lines, scanner.Skipped, total)
+		}
+	})
+}
+
+func FuzzNormalizeDomain(f *testing.F) {
+	for _, seed := range []string{
+		"https://user@API.example.com:8443/path?q",
+		"*.example.com.",
+		"[2001:db8::1]:53",
+		"192.0.2.1",
+		"bücher.example",
+		"a..b",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		host, ok := normalizeDomain(line)
+		if !ok {
+			if host != "" {
+				t.Fatalf("normalizeDomain(%q) = %q with ok false", line, host)
+			}
+			return
+		}
+		if host == "" {
+			t.Fatalf("normalizeDomain(%q) accepted an empty host", line)
+		}
+		// A normalized host is already in its final form
+		if again, ok := normalizeDomain(host); !ok || again != host {
+			t.Fatalf("normalizeDomain(%q) = %q, but normalizing that gives %q, %v", line, host, again, ok)
+		}
+	})
+}
+
+func TestOpenInputReadsPlainAndGzipped(t *testing.T) {
+	read := func(path string) []string {
+		t.Helper()
+		input, err := openInput(path)
+		if err != nil {
+			t.Fatalf("openInput(%s): %v", path, err)
+		}
+		defer input.Close()
+
+		// Two passes, as a multi-level bruteforce makes
+		var lines []string
+		for pass := 0; pass < 2; pass++ {
+			if _, err := input.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("rewinding %s: %v", path, err)
+			}
+			scanner := newLineReader(input)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("reading %s: %v", path, err)
+			}
+		}
+		return lines
+	}
+
+	plain := read("testdata/words.txt")
+	if len(plain) != 12 {
+		t.Fatalf("read %d lines from two passes over words.txt, want 12", len(plain))
+	}
+	if gzipped := read("testdata/words.txt.gz"); !reflect.DeepEqual(gzipped, plain) {
+		t.Errorf("words.txt.gz gave %q, want the lines of words.txt %q", gzipped, plain)
+	}
+
+	// The magic bytes give gzip away without the .gz suffix
+	data, err := os.ReadFile("testdata/words.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(t.TempDir(), "words.lst")
+	if err := os.WriteFile(renamed, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if gzipped := read(renamed); !reflect.DeepEqual(gzipped, plain) {
+		t.Errorf("gzip without the .gz suffix gave %q, want %q", gzipped, plain)
+	}
+}
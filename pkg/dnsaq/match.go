@@ -0,0 +1,42 @@
+package dnsaq
+
+// matchResult applies the -match-ip, -match-name, -filter-ip and
+// -filter-name triage filters, reporting whether result should be written.
+// Where given, a result needs an address in a -match-ip range and a name
+// matching -match-name, and must have neither an address in a -filter-ip
+// range nor a name matching -filter-name. Names are the queried name and
+// its CNAME chain; wildcard filtering has already happened by now.
+func (d *DNSEnumerator) matchResult(result Result) bool {
+	config := d.Config
+	if config.MatchIP == nil && config.FilterIP == nil && config.MatchName == nil && config.FilterName == nil {
+		return true
+	}
+
+	addresses := result.Records
+	if result.Inventory != nil {
+		addresses = append(append([]string{}, result.Inventory["A"]...), result.Inventory["AAAA"]...)
+	}
+	if config.MatchIP != nil && !containsIP(config.MatchIP, addresses) {
+		return false
+	}
+	if config.FilterIP != nil && containsIP(config.FilterIP, addresses) {
+		return false
+	}
+
+	names := append([]string{result.Domain}, result.CNAMEs...)
+	matches := func(matchName func(string) bool) bool {
+		for _, name := range names {
+			if matchName(displayName(name)) {
+				return true
+			}
+		}
+		return false
+	}
+	if config.MatchName != nil && !matches(config.MatchName.MatchString) {
+		return false
+	}
+	if config.FilterName != nil && matches(config.FilterName.MatchString) {
+		return false
+	}
+	return true
+}
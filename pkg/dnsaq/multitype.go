@@ -0,0 +1,140 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ResolveAll looks up several record types for domain and returns the
+// records found per type; types without records are left out. The types
+// are queried concurrently within the -concurrency budget, or with -any as
+// one ANY query whose answer is split by type. It only fails when no type
+// could be looked up. It takes a slot of the budget for itself, so it must
+// not be called from a job already holding one.
+func (d *DNSEnumerator) ResolveAll(domain string, types []uint16) (map[uint16][]string, error) {
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+
+	if d.Config.QueryANY {
+		if found, _, err := d.resolveANY(domain, types); err == nil {
+			return found, nil
+		}
+	}
+
+	found := make(map[uint16][]string)
+	var mu sync.Mutex
+	failures := 0
+	var lastErr error
+	d.fanOut(len(types), func(i int) {
+		records, err := d.ResolveType(domain, types[i])
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures++
+			lastErr = err
+			return
+		}
+		if len(records) > 0 {
+			found[types[i]] = records
+		}
+	})
+
+	if failures == len(types) {
+		return nil, lastErr
+	}
+	return found, nil
+}
+
+// resolveANY sends a single ANY query and splits the answer by type. Many
+// resolvers refuse ANY or answer with a placeholder (RFC 8482), which is
+// reported as an error so callers can fall back to one query per type.
+// The resolver that answered is returned alongside the records.
+func (d *DNSEnumerator) resolveANY(domain string, types []uint16) (map[uint16][]string, string, error) {
+	answer, err := d.Lookup(domain, dns.TypeANY)
+	if err != nil {
+		return nil, "", err
+	}
+
+	wanted := make(map[uint16]bool, len(types))
+	for _, qtype := range types {
+		wanted[qtype] = true
+	}
+	found := make(map[uint16][]string)
+	for _, rr := range answer.RRs {
+		if hinfo, ok := rr.(*dns.HINFO); ok && strings.EqualFold(hinfo.Cpu, "RFC8482") {
+			return nil, "", fmt.Errorf("resolver %s does not answer ANY queries (RFC 8482)", answer.Resolver)
+		}
+		if qtype := rr.Header().Rrtype; wanted[qtype] {
+			found[qtype] = append(found[qtype], recordValue(rr))
+		}
+	}
+	return found, answer.Resolver, nil
+}
+
+// processTypes resolves every -type for domain. With -any the types come
+// from one ANY query when the resolver supports it; otherwise the types are
+// queried concurrently within the -concurrency budget, pacing all but the
+// first through the rate limiter.
+func (d *DNSEnumerator) processTypes(domain string, types []uint16, results chan<- Result) {
+	if d.Config.QueryANY && d.processANY(domain, types, results) {
+		return
+	}
+
+	// A name counts as resolved once, however many of its types answered
+	var resolved int32
+	d.fanOut(len(types), func(i int) {
+		if d.processQuery(domain, types[i], QueryFlags{}, results) {
+			atomic.StoreInt32(&resolved, 1)
+		}
+	})
+	if atomic.LoadInt32(&resolved) != 0 {
+		atomic.AddInt64(&d.stats.Resolved, 1)
+	}
+}
+
+// processANY writes one result per requested type found in an ANY answer,
+// reporting false when the resolver wouldn't answer ANY
+func (d *DNSEnumerator) processANY(domain string, types []uint16, results chan<- Result) bool {
+	found, resolver, err := d.resolveANY(domain, types)
+	if err != nil {
+		if isNXDomain(err) {
+			atomic.AddInt64(&d.stats.NXDomain, 1)
+			return true
+		}
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "ANY query for %s failed, querying each type: %v\n", domain, err)
+		}
+		return false
+	}
+
+	d.awaitWildcard(domain)
+	resolved := false
+	for _, qtype := range types {
+		records := found[qtype]
+		if len(records) == 0 {
+			continue
+		}
+		if d.isWildcardResponse(domain, records) {
+			atomic.AddInt64(&d.stats.WildcardFiltered, 1)
+			continue
+		}
+		resolved = true
+		d.sendResult(results, Result{
+			Domain:    domain,
+			Type:      dns.TypeToString[qtype],
+			Records:   d.capAnswers(records),
+			Resolver:  resolver,
+			Timestamp: time.Now().UTC(),
+		})
+	}
+	if resolved {
+		atomic.AddInt64(&d.stats.Resolved, 1)
+	}
+	return true
+}
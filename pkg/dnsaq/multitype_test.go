@@ -0,0 +1,161 @@
+package dnsaq
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// peakServer answers every query NXDOMAIN after a short delay and records
+// the most queries it had in flight at once
+type peakServer struct {
+	*mockServer
+
+	mutex          sync.Mutex
+	inFlight, peak int
+}
+
+func newPeakServer(t *testing.T) *peakServer {
+	server := &peakServer{}
+	server.mockServer = newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		server.mutex.Lock()
+		server.inFlight++
+		server.peak = max(server.peak, server.inFlight)
+		server.mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		server.mutex.Lock()
+		server.inFlight--
+		server.mutex.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype != dns.TypeA {
+			m.Rcode = dns.RcodeNameError
+		} else {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	return server
+}
+
+func (s *peakServer) Peak() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.peak
+}
+
+func TestResolveAllQueriesTypesConcurrently(t *testing.T) {
+	server := newPeakServer(t)
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.Concurrency = 3
+	})
+
+	types := []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT, dns.TypeNS, dns.TypeCAA}
+	found, err := d.ResolveAll("www.example.test", types)
+	if err != nil {
+		t.Fatalf("ResolveAll: %v", err)
+	}
+	if len(found) != 1 || len(found[dns.TypeA]) != 1 {
+		t.Errorf("ResolveAll = %v, want only the A record", found)
+	}
+	if got := len(server.Queries()); got != len(types) {
+		t.Errorf("resolver got %d queries, want one per type (%d)", got, len(types))
+	}
+	if peak := server.Peak(); peak < 2 || peak > 3 {
+		t.Errorf("%d types were queried at once, want 2 to -concurrency 3", peak)
+	}
+}
+
+func TestPerNameLookupsStayWithinConcurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*DNSConfig)
+		setup     func(*DNSEnumerator)
+	}{
+		{"types", func(config *DNSConfig) {
+			config.QueryTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT}
+		}, nil},
+		{"srv", func(config *DNSConfig) {
+			config.SRV = true
+		}, func(d *DNSEnumerator) {
+			d.srvServices = []string{"_ldap._tcp", "_sip._tcp", "_xmpp-client._tcp", "_imaps._tcp"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fewer names than workers leave slots for fan-out to fill; more
+			// names keep every slot busy with workers
+			for _, names := range []int{2, 40} {
+				server := newPeakServer(t)
+				const concurrency = 4
+				d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+					config.Concurrency = concurrency
+					tt.configure(config)
+				})
+				if tt.setup != nil {
+					tt.setup(d)
+				}
+
+				var input strings.Builder
+				for i := 0; i < names; i++ {
+					fmt.Fprintf(&input, "host%d.example.test\n", i)
+				}
+				d.EnumerateFromReader(context.Background(), bufio.NewReader(strings.NewReader(input.String())))
+
+				if got, want := len(server.Queries()), names*4; got != want {
+					t.Errorf("%d names: resolver got %d queries, want %d", names, got, want)
+				}
+				if peak := server.Peak(); peak > concurrency {
+					t.Errorf("%d names: %d queries ran at once, want at most -concurrency %d", names, peak, concurrency)
+				} else if names < concurrency && peak <= names {
+					t.Errorf("%d names: %d queries ran at once, want the types of a name queried concurrently", names, peak)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiTypeNameCountsAsResolvedOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		any  bool
+	}{
+		{"types", false},
+		{"any", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockServer(t, zoneHandler(map[string][]string{
+				"www.example.test. A":    {"www.example.test. 60 IN A 192.0.2.1"},
+				"www.example.test. AAAA": {"www.example.test. 60 IN AAAA 2001:db8::1"},
+				"www.example.test. MX":   {"www.example.test. 60 IN MX 10 mx.example.test."},
+				"www.example.test. ANY": {
+					"www.example.test. 60 IN A 192.0.2.1",
+					"www.example.test. 60 IN AAAA 2001:db8::1",
+					"www.example.test. 60 IN MX 10 mx.example.test.",
+				},
+			}))
+			d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+				config.QueryTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX}
+				config.QueryANY = tt.any
+			})
+
+			results := d.ResolveNames(context.Background(), []string{"www.example.test"})
+			if len(results) != 3 {
+				t.Errorf("got %d results, want one per type", len(results))
+			}
+			if got := d.Resolved(); got != 1 {
+				t.Errorf("Resolved = %d for one name with three types, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MXHost is a mail server of a domain as reported by -mx
+type MXHost struct {
+	Preference uint16 `json:"preference"`
+	Host       string `json:"host"`
+	// Implicit marks the domain standing in as its own mail server because it
+	// has no MX records (RFC 5321 section 5.1)
+	Implicit bool `json:"implicit,omitempty"`
+}
+
+// processMX looks up the mail servers of a domain for -mx mode, writing one
+// result per server in preference order. With -mx-resolve each server's
+// addresses are looked up too.
+func (d *DNSEnumerator) processMX(domain string, results chan<- Result) {
+	answer, err := d.Lookup(domain, dns.TypeMX)
+	if err != nil {
+		if isNXDomain(err) {
+			atomic.AddInt64(&d.stats.NXDomain, 1)
+		}
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Error resolving %s MX: %v\n", domain, err)
+		}
+		return
+	}
+
+	hosts := mxHosts(answer.RRs)
+	if len(hosts) == 0 {
+		if !d.Config.MXFallback {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "No MX records for %s\n", domain)
+			}
+			return
+		}
+		hosts = []MXHost{{Host: strings.TrimSuffix(domain, "."), Implicit: true}}
+	}
+	atomic.AddInt64(&d.stats.Resolved, 1)
+
+	for _, host := range hosts {
+		host := host
+		result := Result{
+			Domain:    domain,
+			Type:      dns.TypeToString[dns.TypeMX],
+			MX:        &host,
+			Resolver:  answer.Resolver,
+			Timestamp: time.Now().UTC(),
+		}
+
+		// A null MX ("0 .") says the domain accepts no mail, so there is no host to resolve
+		if (d.Config.MXResolve || host.Implicit) && host.Host != "." {
+			d.wait()
+			addresses, err := d.hostAddresses(host.Host)
+			if err != nil {
+				if d.Config.Verbose {
+					fmt.Fprintf(os.Stderr, "Error resolving mail host %s: %v\n", host.Host, err)
+				}
+				if host.Implicit {
+					continue
+				}
+			} else {
+				result.Records = d.capAnswers(addresses.Records)
+				result.Resolver = addresses.Resolver
+			}
+		}
+		d.sendResult(results, result)
+	}
+}
+
+// hostAddresses looks up the addresses of a server, AAAA included
+// with -6
+func (d *DNSEnumerator) hostAddresses(host string) (*Answer, error) {
+	if d.Config.IPv6 {
+		return d.lookupAddresses(host, QueryFlags{})
+	}
+	return d.Lookup(host, dns.TypeA)
+}
+
+// mxHosts extracts the MX records of an answer, sorted by preference and
+// then host name so the output is stable
+func mxHosts(rrs []dns.RR) []MXHost {
+	var hosts []MXHost
+	for _, rr := range rrs {
+		if mx, ok := rr.(*dns.MX); ok {
+			host := strings.TrimSuffix(mx.Mx, ".")
+			if host == "" {
+				host = "."
+			}
+			hosts = append(hosts, MXHost{Preference: mx.Preference, Host: host})
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Preference != hosts[j].Preference {
+			return hosts[i].Preference < hosts[j].Preference
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+	return hosts
+}
@@ -0,0 +1,122 @@
+package dnsaq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// nsecBufSize is the EDNS0 buffer advertised by -nsec-walk queries, large
+// enough for signed answers
+const nsecBufSize = 4096
+
+// WalkNSEC enumerates a DNSSEC-signed zone by following its NSEC chain from
+// the apex until it loops back, resolving every name found along the way.
+// Zones signed with NSEC3 only expose hashed names and are reported as such.
+func (d *DNSEnumerator) WalkNSEC(ctx context.Context, domain string) {
+	defer d.stopWith(ctx)()
+
+	apex := dns.CanonicalName(domain)
+	zone := strings.TrimSuffix(apex, ".")
+	d.startWildcardCheck(apex)
+
+	results := d.newResults()
+	written := make(chan struct{})
+
+	// Process results
+	go d.writeResults(results, written)
+
+	pool := d.newWorkerPool()
+	seen := map[string]bool{apex: true}
+	for name := apex; !d.stopped(); {
+		next, err := d.nextSecure(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "NSEC walk of %s stopped at %s: %v\n", zone, strings.TrimSuffix(name, "."), err)
+			break
+		}
+		if next == apex || seen[next] || !dns.IsSubDomain(apex, next) {
+			break
+		}
+		seen[next] = true
+		name = next
+
+		// Wildcard owners and other synthetic labels are not names to resolve
+		if strings.HasPrefix(next, "*.") {
+			continue
+		}
+		found := strings.TrimSuffix(next, ".")
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "NSEC walk found %s\n", found)
+		}
+		d.wait()
+		pool.Submit(func() {
+			d.ProcessDomain(found, results)
+		})
+	}
+
+	pool.Wait()
+	close(results)
+	<-written
+	d.reportRun()
+
+	if d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "NSEC walk of %s found %d names\n", zone, len(seen)-1)
+	}
+}
+
+// nextSecure returns the name following name in its zone's NSEC chain. It
+// asks for the NSEC record of name itself, and failing that for a name just
+// after it, whose denial of existence carries the covering NSEC record.
+func (d *DNSEnumerator) nextSecure(name string) (string, error) {
+	for _, query := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{name, dns.TypeNSEC},
+		{"\\000." + name, dns.TypeA},
+	} {
+		resp, err := d.querySigned(query.name, query.qtype)
+		if err != nil {
+			return "", err
+		}
+
+		for _, rr := range append(resp.Answer, resp.Ns...) {
+			switch record := rr.(type) {
+			case *dns.NSEC:
+				if dns.CanonicalName(record.Hdr.Name) == name {
+					return dns.CanonicalName(record.NextDomain), nil
+				}
+			case *dns.NSEC3:
+				return "", fmt.Errorf("zone is signed with NSEC3, which only exposes hashed names")
+			}
+		}
+	}
+	return "", fmt.Errorf("no NSEC record returned; the zone may not be DNSSEC-signed")
+}
+
+// querySigned sends a query with the DNSSEC OK bit set and returns the
+// first response from any resolver, whatever its rcode
+func (d *DNSEnumerator) querySigned(name string, qtype uint16) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(name, qtype)
+	msg.SetEdns0(nsecBufSize, true)
+
+	for _, resolver := range d.resolverOrder() {
+		d.wait()
+		resp, _, err := d.exchange(d.client, msg, resolver)
+		if err == nil && resp.Truncated {
+			resp, _, err = d.exchange(d.tcpClient, msg, resolver)
+		}
+		if err != nil {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Resolver %s failed: %v\n", resolver, err)
+			}
+			continue
+		}
+		return resp, nil
+	}
+	return nil, errAllResolversFailed
+}
@@ -0,0 +1,669 @@
+package dnsaq
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Output formats accepted by -stdout-format and -file-format
+const (
+	FormatPlain = "plain"
+	FormatJSON  = "json"
+	FormatGrep  = "grep"
+	FormatCSV   = "csv"
+)
+
+// statusNoData marks a NOERROR answer without records of the queried type
+const statusNoData = "NODATA"
+
+// statusWildcard marks an -all-results name whose answer was filtered as a
+// wildcard response
+const statusWildcard = "WILDCARD"
+
+// statusError marks a failed lookup, and the ResolverAnswer of a resolver
+// that did not answer
+const statusError = "ERROR"
+
+// csvHeader is the column layout of FormatCSV output
+var csvHeader = []string{"domain", "type", "record", "resolver"}
+
+// Result is a resolved name as handed to the output sinks
+type Result struct {
+	Domain   string   `json:"domain"`
+	Type     string   `json:"type"`
+	Records  []string `json:"records"`
+	Resolver string   `json:"resolver,omitempty"`
+	// RTT is the resolver's answer time in milliseconds
+	RTT     float64  `json:"rtt_ms,omitempty"`
+	Raw     []string `json:"raw,omitempty"`
+	Private bool     `json:"private,omitempty"`
+
+	// CNAMEs is the alias chain followed from Domain, e.g. [cdn.example.net]
+	CNAMEs []string `json:"cname_chain,omitempty"`
+	// Dangling marks a CNAME chain ending in a name that does not exist
+	Dangling bool `json:"dangling,omitempty"`
+	// Takeover is set by -takeover when the CNAME chain points at a service
+	// that looks unclaimed
+	Takeover *Takeover `json:"takeover,omitempty"`
+	// Status says why a name is reported without records: NXDOMAIN,
+	// statusNoData for a name that exists without the queried type,
+	// statusWildcard for a filtered wildcard answer or statusError for a
+	// failed lookup
+	Status string `json:"status,omitempty"`
+	// Error is why the lookup failed, e.g. a timeout or SERVFAIL from every
+	// resolver. Failed results reach Enumerate callers, and the output sinks
+	// only with -all-results.
+	Error string `json:"error,omitempty"`
+
+	// MX is the mail server of a -mx result; Records then holds its addresses
+	MX *MXHost `json:"mx,omitempty"`
+
+	// SRV is the server of a -srv result; Records then holds its addresses
+	SRV *SRVTarget `json:"srv,omitempty"`
+
+	// Mail is the SPF and DMARC summary of a -spf result; Records then holds
+	// the flattened senders
+	Mail *MailPolicy `json:"mail_policy,omitempty"`
+
+	// Discrepancy marks a -query-all-resolvers result the resolvers disagreed
+	// on; Answers then holds each resolver's answer and Records their union
+	Discrepancy bool             `json:"discrepancy,omitempty"`
+	Answers     []ResolverAnswer `json:"resolver_answers,omitempty"`
+
+	// NS is the delegation of the result's base domain with -show-ns
+	NS *Delegation `json:"ns,omitempty"`
+
+	// Owners maps each resolved address to its network owner with -asn-db
+	Owners map[string]Owner `json:"owners,omitempty"`
+
+	// Inventory maps record type to records for -discover results
+	Inventory map[string][]string `json:"inventory,omitempty"`
+
+	// Class is the query class of runs with a -class other than IN
+	Class string `json:"class,omitempty"`
+
+	// Timestamp is when the result was resolved
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ParseOutputFormat validates an output format name
+func ParseOutputFormat(name string) (string, error) {
+	switch format := strings.ToLower(name); format {
+	case FormatPlain, FormatJSON, FormatGrep, FormatCSV:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (supported: %s, %s, %s, %s)", name, FormatPlain, FormatJSON, FormatGrep, FormatCSV)
+}
+
+// FormatForFile picks the file format from the extension when none was given
+func FormatForFile(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	}
+	return FormatPlain
+}
+
+// formatResult renders a result as a single output line. labelType adds the
+// record type to plain lines, for runs that query more than one type, and
+// withStatus adds the status column to CSV rows for -all-results.
+func formatResult(result Result, format string, labelType, withStatus bool) string {
+	switch format {
+	case FormatJSON:
+		if result.Records == nil {
+			result.Records = []string{}
+		}
+		line, _ := json.Marshal(result)
+		return string(line)
+	case FormatGrep:
+		return formatGrep(result)
+	case FormatCSV:
+		rows := csvRows(result)
+		if withStatus {
+			status := resultStatus(result)
+			for i := range rows {
+				rows[i] = append(rows[i], status)
+			}
+		}
+		return csvLines(rows...)
+	}
+
+	// -raw keeps the usual line, markers and all, with the answer records as
+	// received on the lines below it
+	line := formatPlain(result, labelType)
+	if len(result.Raw) > 0 {
+		line += "\n" + strings.Join(result.Raw, "\n")
+	}
+	return line
+}
+
+// formatPlain renders the one-line plain layout; with -raw the parsed
+// values are left out, since the raw records follow
+func formatPlain(result Result, labelType bool) string {
+	if result.Inventory != nil {
+		return formatInventory(result)
+	}
+	line := result.Domain
+	if result.MX != nil {
+		line += fmt.Sprintf(" -> %d %s", result.MX.Preference, result.MX.Host)
+		if len(result.Records) > 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(result.Records, ", "))
+		}
+		if result.MX.Implicit {
+			line += " [IMPLICIT MX]"
+		}
+		return line
+	}
+	if result.SRV != nil {
+		line += " -> " + result.SRV.String()
+		if len(result.Records) > 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(result.Records, ", "))
+		}
+		return line
+	}
+	if result.Mail != nil {
+		return line + formatMailPolicy(result)
+	}
+	if labelType {
+		line += " " + result.Type
+	}
+	for _, target := range result.CNAMEs {
+		line += " -> " + target
+	}
+	if result.Dangling {
+		return line + " [DANGLING CNAME]" + formatTakeover(result.Takeover)
+	}
+	if result.Status != "" {
+		line += " [" + result.Status + "]"
+		if result.Error != "" {
+			line += " " + result.Error
+		}
+		return line
+	}
+	if result.Discrepancy {
+		return line + " [DISCREPANCY] " + formatAnswers(result.Answers)
+	}
+	if len(result.Raw) == 0 {
+		line += fmt.Sprintf(" [%s]", strings.Join(result.Records, ", "))
+	}
+	if result.Private {
+		line += " [PRIVATE]"
+	}
+	if result.Owners != nil {
+		line += " [OWNER " + formatOwners(result.Records, result.Owners) + "]"
+	}
+	line += formatTakeover(result.Takeover)
+	if result.NS != nil {
+		line += fmt.Sprintf(" [NS %s]", strings.Join(result.NS.Nameservers, ", "))
+		if result.NS.Serial != 0 {
+			line += fmt.Sprintf(" [SOA %d]", result.NS.Serial)
+		}
+	}
+	return line
+}
+
+// formatGrep renders the nmap-greppable style layout. The field names and
+// their order are part of the output contract; only append new fields.
+func formatGrep(result Result) string {
+	records := strings.Join(result.Records, ",")
+	if result.Inventory != nil {
+		records = strings.TrimPrefix(formatInventory(Result{Inventory: result.Inventory}), " ")
+	}
+
+	line := fmt.Sprintf("Host: %s\tType: %s\tRecords: %s\tResolver: %s", result.Domain, result.Type, records, result.Resolver)
+	var flags []string
+	if result.Private {
+		flags = append(flags, "PRIVATE")
+	}
+	if result.Dangling {
+		flags = append(flags, "DANGLING")
+	}
+	if result.Takeover != nil {
+		flags = append(flags, "TAKEOVER")
+	}
+	if result.Status != "" {
+		flags = append(flags, result.Status)
+	}
+	if result.Discrepancy {
+		flags = append(flags, "DISCREPANCY")
+	}
+	if len(flags) > 0 {
+		line += "\tFlags: " + strings.Join(flags, ",")
+	}
+	if len(result.CNAMEs) > 0 {
+		line += "\tCNAME: " + strings.Join(result.CNAMEs, ",")
+	}
+	if result.Mail != nil {
+		line += fmt.Sprintf("\tSPF lookups: %d\tDMARC: %s", result.Mail.Lookups, result.Mail.Policy)
+	}
+	if result.MX != nil {
+		line += fmt.Sprintf("\tMX: %d %s", result.MX.Preference, result.MX.Host)
+		if result.MX.Implicit {
+			line += " (implicit)"
+		}
+	}
+	if result.SRV != nil {
+		line += "\tSRV: " + result.SRV.String()
+	}
+	if result.Discrepancy {
+		line += "\tAnswers: " + formatAnswers(result.Answers)
+	}
+	if result.NS != nil {
+		line += "\tNS: " + strings.Join(result.NS.Nameservers, ",")
+		if result.NS.Serial != 0 {
+			line += fmt.Sprintf("\tSOA serial: %d", result.NS.Serial)
+		}
+	}
+	if result.Owners != nil {
+		line += "\tOwner: " + formatOwners(resultAddresses(result), result.Owners)
+	}
+	if result.Error != "" {
+		line += "\tError: " + result.Error
+	}
+	if result.Takeover != nil {
+		line += fmt.Sprintf("\tTakeover: %s (%s)", result.Takeover.Service, result.Takeover.Reason)
+	}
+	return line
+}
+
+// formatTakeover renders the plain suffix of a -takeover candidate, e.g.
+// " [POSSIBLE TAKEOVER: Heroku (NXDOMAIN), verify manually]"
+func formatTakeover(takeover *Takeover) string {
+	if takeover == nil {
+		return ""
+	}
+	return fmt.Sprintf(" [POSSIBLE TAKEOVER: %s (%s), verify manually]", takeover.Service, takeover.Reason)
+}
+
+// csvRows lays a result out as one csvHeader row per record. Names without
+// records, like NXDOMAIN or dangling results, get a single row with an
+// empty record.
+func csvRows(result Result) [][]string {
+	var rows [][]string
+	if result.MX != nil || result.SRV != nil {
+		// The server row, then one row per address of the server itself
+		host, value := "", ""
+		if result.MX != nil {
+			host, value = result.MX.Host, fmt.Sprintf("%d %s", result.MX.Preference, result.MX.Host)
+		} else {
+			host, value = result.SRV.Target, result.SRV.String()
+		}
+		rows = append(rows, []string{result.Domain, result.Type, value, result.Resolver})
+		for _, record := range result.Records {
+			qtype := "A"
+			if ip := net.ParseIP(record); ip != nil && ip.To4() == nil {
+				qtype = "AAAA"
+			}
+			rows = append(rows, []string{host, qtype, record, result.Resolver})
+		}
+		return rows
+	}
+	if result.Mail != nil {
+		for _, sender := range result.Records {
+			rows = append(rows, []string{result.Domain, result.Type, sender, result.Resolver})
+		}
+		if result.Mail.DMARC != "" {
+			rows = append(rows, []string{result.Domain, "DMARC", result.Mail.DMARC, result.Resolver})
+		}
+	} else if result.Discrepancy {
+		// One row per record and resolver, so the resolver column shows who said what
+		for _, answer := range result.Answers {
+			if len(answer.Records) == 0 {
+				rows = append(rows, []string{result.Domain, result.Type, answer.Status, answer.Resolver})
+			}
+			for _, record := range answer.Records {
+				rows = append(rows, []string{result.Domain, result.Type, record, answer.Resolver})
+			}
+		}
+	} else if result.Inventory != nil {
+		for _, qtype := range discoverTypes {
+			name := dns.TypeToString[qtype]
+			for _, record := range result.Inventory[name] {
+				rows = append(rows, []string{result.Domain, name, record, result.Resolver})
+			}
+		}
+	} else {
+		for _, record := range result.Records {
+			rows = append(rows, []string{result.Domain, result.Type, record, result.Resolver})
+		}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, []string{result.Domain, result.Type, "", result.Resolver})
+	}
+	return rows
+}
+
+// resultStatus is the -all-results status of a result: its Status, or
+// NOERROR for a name that resolved
+func resultStatus(result Result) string {
+	if result.Status != "" {
+		return result.Status
+	}
+	return dns.RcodeToString[dns.RcodeSuccess]
+}
+
+// csvLines encodes rows as CSV without the final line break, quoting values
+// such as TXT records that contain commas
+func csvLines(rows ...[]string) string {
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+	writer.WriteAll(rows)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// formatMailPolicy renders the plain suffix of a -spf result, e.g.
+// " [ip4:192.0.2.0/24] [SPF lookups: 3/10] [DMARC p=reject]"
+func formatMailPolicy(result Result) string {
+	mail := result.Mail
+	line := ""
+	if mail.SPF != "" {
+		line += fmt.Sprintf(" [%s] [SPF lookups: %d/%d]", strings.Join(result.Records, ", "), mail.Lookups, spfLookupLimit)
+		if len(mail.Unresolved) > 0 {
+			line += fmt.Sprintf(" [UNRESOLVED %s]", strings.Join(mail.Unresolved, " "))
+		}
+	} else {
+		line += " [NO SPF]"
+	}
+	if mail.DMARC != "" {
+		line += fmt.Sprintf(" [DMARC p=%s]", mail.Policy)
+	} else {
+		line += " [NO DMARC]"
+	}
+	return line
+}
+
+// formatInventory renders a -discover result in discoverTypes order,
+// e.g. "example.com A=[1.2.3.4] MX=[10 mail.example.com.]"
+func formatInventory(result Result) string {
+	parts := []string{result.Domain}
+	for _, qtype := range discoverTypes {
+		name := dns.TypeToString[qtype]
+		if records, ok := result.Inventory[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s=[%s]", name, strings.Join(records, ", ")))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+const (
+	// outputFlushInterval is how often buffered sinks are flushed unless
+	// -flush-interval says otherwise, bounding how much output a killed
+	// process can lose
+	outputFlushInterval = time.Second
+	// batchBufferSize is the sink buffer with -batch-size, big enough that
+	// a batch of lines usually goes out in a single write
+	batchBufferSize = 64 << 10
+	// resultBuffer is how many results may wait for the writer before
+	// workers block, unless -batch-size asks for more
+	resultBuffer = 100
+)
+
+// outputSink is one destination for output, stdout, the -o file or the
+// -webhook, with its own format
+type outputSink struct {
+	writer *bufio.Writer
+	format string
+	// batch is how many lines the sink holds before flushing: 1 for stdout,
+	// so output shows up immediately, -batch-size when set, and 0 to leave
+	// flushing to the buffer and the periodic flush
+	batch       int
+	pending     int
+	wroteHeader bool
+	// resultsOnly sinks skip the free-form lines of writeLine
+	resultsOnly bool
+	// seen is set for -silent stdout, which writes each resolved name once
+	seen map[string]bool
+}
+
+// newOutputSink wraps w in a buffered sink writing the given format,
+// flushed every batch lines
+func newOutputSink(w io.Writer, format string, batch int) *outputSink {
+	size := 4096
+	if batch > 1 {
+		size = batchBufferSize
+	}
+	return &outputSink{writer: bufio.NewWriterSize(w, size), format: format, batch: batch}
+}
+
+// write appends line and a newline to the sink, flushing once a batch is
+// complete
+func (s *outputSink) write(line string) {
+	s.writer.WriteString(line)
+	s.writer.WriteByte('\n')
+	if s.pending++; s.batch > 0 && s.pending >= s.batch {
+		s.flush()
+	}
+}
+
+// flush writes out the buffered lines
+func (s *outputSink) flush() error {
+	s.pending = 0
+	return s.writer.Flush()
+}
+
+// emit writes one line per sink, rendered for that sink by render; an empty
+// rendering skips the sink. Holding the mutex keeps lines from concurrent
+// writers from interleaving.
+func (d *DNSEnumerator) emit(render func(sink *outputSink) string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, sink := range d.sinks {
+		if line := render(sink); line != "" {
+			sink.write(line)
+		}
+	}
+}
+
+// flushSinks writes out whatever the sinks and the -resume record have buffered
+func (d *DNSEnumerator) flushSinks() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, sink := range d.sinks {
+		if err := sink.flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		}
+	}
+	if d.resume != nil {
+		if err := d.resume.writer.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing resume file: %v\n", err)
+		}
+	}
+}
+
+// flushPeriodically flushes the sinks every -flush-interval until Close
+func (d *DNSEnumerator) flushPeriodically() {
+	interval := d.Config.FlushInterval
+	if interval <= 0 {
+		interval = outputFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.flushSinks()
+		case <-d.flushDone:
+			return
+		}
+	}
+}
+
+// WriteOutput renders a result for stdout and the output file (if specified),
+// each in its own configured format, with internationalized names in Unicode
+func (d *DNSEnumerator) WriteOutput(result Result) {
+	labelType := len(d.Config.QueryTypes) > 1
+	result.Domain = displayName(result.Domain)
+	if len(result.CNAMEs) > 0 {
+		chain := make([]string, len(result.CNAMEs))
+		for i, target := range result.CNAMEs {
+			chain[i] = displayName(target)
+		}
+		result.CNAMEs = chain
+	}
+	d.emit(func(sink *outputSink) string {
+		if sink.seen != nil {
+			// -silent: bare names that resolved, for piping into the next tool;
+			// a dangling CNAME has no status but resolves to nothing
+			if result.Status != "" || result.Dangling || sink.seen[result.Domain] {
+				return ""
+			}
+			sink.seen[result.Domain] = true
+			return result.Domain
+		}
+		line := formatResult(result, sink.format, labelType, d.Config.AllResults)
+		if sink.format == FormatCSV && !sink.wroteHeader {
+			sink.wroteHeader = true
+			header := csvHeader
+			if d.Config.AllResults {
+				header = append(append([]string{}, csvHeader...), "status")
+			}
+			line = csvLines(header) + "\n" + line
+		}
+		return line
+	})
+}
+
+// writeLine writes a pre-formatted line to stdout and the output file
+func (d *DNSEnumerator) writeLine(line string) {
+	d.emit(func(sink *outputSink) string {
+		if sink.resultsOnly {
+			return ""
+		}
+		return line
+	})
+}
+
+// writeNoData records a NODATA name, one bare name per line so the file can
+// be fed straight back in with another -type
+func (d *DNSEnumerator) writeNoData(domain string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.noDataFile.WriteString(domain + "\n")
+}
+
+// newResults makes the channel a run's workers send their results to,
+// holding at least a -batch-size of them so workers rarely wait on the
+// writer mid-batch
+func (d *DNSEnumerator) newResults() chan Result {
+	size := resultBuffer
+	if d.Config.BatchSize > size {
+		size = d.Config.BatchSize
+	}
+	return make(chan Result, size)
+}
+
+// backpressureWarnAfter is how many blocked result sends we tolerate before
+// warning that the output sink is the bottleneck
+const backpressureWarnAfter = 100
+
+// sendResult queues a result for output, adding the base domain's
+// nameservers under -show-ns and the query class under -class. When the
+// channel is full the send blocks the worker, so count it and warn once it
+// keeps happening.
+func (d *DNSEnumerator) sendResult(results chan<- Result, result Result) {
+	if d.Config.ShowNS && len(result.Records) > 0 && result.Status == "" && !isIP(result.Domain) {
+		result.NS = d.delegation(result.Domain)
+	}
+	if d.Config.QueryClass != 0 && d.Config.QueryClass != dns.ClassINET {
+		result.Class = dns.ClassToString[d.Config.QueryClass]
+	}
+
+	select {
+	case results <- result:
+		return
+	default:
+	}
+
+	if atomic.AddInt64(&d.blockedSends, 1) == backpressureWarnAfter && !d.quiet() {
+		fmt.Fprintf(os.Stderr, "[!] Output is falling behind: %d result sends blocked on a full buffer; workers are being throttled by the output sink\n", backpressureWarnAfter)
+	}
+	results <- result
+}
+
+// reportBackpressure prints the number of blocked result sends for the run
+func (d *DNSEnumerator) reportBackpressure() {
+	if blocked := atomic.LoadInt64(&d.blockedSends); blocked > 0 && d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Output backpressure: %d result sends blocked waiting for the writer\n", blocked)
+	}
+}
+
+// writeResults drains the results channel into the output sinks and closes
+// done once the channel is closed and everything has been written
+func (d *DNSEnumerator) writeResults(results <-chan Result, done chan<- struct{}) {
+	defer close(done)
+
+	if d.Config.GroupByIP {
+		d.writeGroupedByIP(results)
+		return
+	}
+	for result := range results {
+		if (result.Error == "" || d.Config.AllResults) && d.matchResult(result) && d.admitResult() {
+			result.Owners = d.lookupOwners(resultAddresses(result))
+			d.WriteOutput(result)
+		}
+	}
+}
+
+// admitResult counts a result against -max-results, reporting whether it
+// may still be output. Reaching the cap stops the run; results from queries
+// that were already in flight are drained and dropped.
+func (d *DNSEnumerator) admitResult() bool {
+	limit := d.Config.MaxResults
+	if limit <= 0 {
+		return true
+	}
+
+	n := atomic.AddInt64(&d.emitted, 1)
+	if n == limit {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Reached -max-results %d, stopping\n", limit)
+		}
+		d.Stop()
+	}
+	return n <= limit
+}
+
+// writeGroupedByIP buffers the whole run and then writes one line per
+// address listing every name that resolved to it, in first-seen order,
+// e.g. "1.2.3.4: a.example.com, b.example.com". With -asn-db the address
+// is followed by its owner.
+func (d *DNSEnumerator) writeGroupedByIP(results <-chan Result) {
+	var order []string
+	names := make(map[string][]string)
+
+	for result := range results {
+		if result.Error != "" || !d.matchResult(result) || !d.admitResult() {
+			continue
+		}
+		for _, record := range resultAddresses(result) {
+			if net.ParseIP(record) == nil {
+				continue
+			}
+			if _, seen := names[record]; !seen {
+				order = append(order, record)
+			}
+			names[record] = append(names[record], displayName(result.Domain))
+		}
+	}
+
+	for _, ip := range order {
+		if owner := d.lookupOwners([]string{ip}); owner != nil {
+			d.writeLine(fmt.Sprintf("%s (%s): %s", ip, owner[ip], strings.Join(names[ip], ", ")))
+			continue
+		}
+		d.writeLine(fmt.Sprintf("%s: %s", ip, strings.Join(names[ip], ", ")))
+	}
+}
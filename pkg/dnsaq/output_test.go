@@ -0,0 +1,135 @@
+package dnsaq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSilentOutputSkipsDanglingCNAMEs(t *testing.T) {
+	server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch strings.ToLower(r.Question[0].Name) {
+		case "www.example.test.":
+			rr, _ := dns.NewRR("www.example.test. 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		case "old.example.test.":
+			// The CNAME target is gone, so the answer is NXDOMAIN with the CNAME
+			rr, _ := dns.NewRR("old.example.test. 60 IN CNAME gone.cloud.test.")
+			m.Answer = append(m.Answer, rr)
+			m.Rcode = dns.RcodeNameError
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+	var stdout bytes.Buffer
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.Silent = true
+		config.Stdout = &stdout
+	})
+
+	d.EnumerateFromReader(context.Background(), bufio.NewReader(strings.NewReader("www.example.test\nold.example.test\n")))
+	d.Close()
+
+	if got := stdout.String(); got != "www.example.test\n" {
+		t.Errorf("-silent output = %q, want only the name that resolved", got)
+	}
+}
+
+func TestCSVHeaderWrittenOncePerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	result := Result{Domain: "www.example.test", Type: "A", Records: []string{"192.0.2.1"}, Resolver: "127.0.0.1:53"}
+
+	// Appending runs add rows under the first run's header; -overwrite starts over
+	for _, run := range []struct {
+		overwrite bool
+		want      string
+	}{
+		{false, "domain,type,record,resolver\nwww.example.test,A,192.0.2.1,127.0.0.1:53\n"},
+		{false, "domain,type,record,resolver\nwww.example.test,A,192.0.2.1,127.0.0.1:53\nwww.example.test,A,192.0.2.1,127.0.0.1:53\n"},
+		{true, "domain,type,record,resolver\nwww.example.test,A,192.0.2.1,127.0.0.1:53\n"},
+	} {
+		d := newTestEnumerator(t, nil, func(config *DNSConfig) {
+			config.OutputFile = path
+			config.FileFormat = FormatCSV
+			config.Overwrite = run.overwrite
+		})
+		d.WriteOutput(result)
+		d.Close()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != run.want {
+			t.Errorf("-o file after a run with -overwrite=%v:\n%s\nwant:\n%s", run.overwrite, data, run.want)
+		}
+	}
+}
+
+func TestFormatPlainRawKeepsPrefix(t *testing.T) {
+	result := Result{
+		Domain:  "db.example.test",
+		Type:    "A",
+		Records: []string{"10.0.0.5"},
+		Private: true,
+		Raw:     []string{"db.example.test.\t60\tIN\tA\t10.0.0.5"},
+	}
+	want := "db.example.test A [PRIVATE]\ndb.example.test.\t60\tIN\tA\t10.0.0.5"
+	if got := formatResult(result, FormatPlain, true, false); got != want {
+		t.Errorf("formatResult with -raw = %q, want %q", got, want)
+	}
+}
+
+// countingWriter discards what it is given, counting the writes that would
+// each be a system call on a real stdout
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+func BenchmarkWriteOutput(b *testing.B) {
+	result := Result{
+		Domain:    "www.example.com",
+		Type:      "A",
+		Records:   []string{"192.0.2.1", "192.0.2.2"},
+		Resolver:  "127.0.0.1:53",
+		Timestamp: time.Now().UTC(),
+	}
+	for _, format := range []string{FormatPlain, FormatJSON} {
+		// 0 flushes stdout after every line, the default without -batch-size
+		for _, batch := range []int{0, 1000} {
+			b.Run(fmt.Sprintf("%s/batch=%d", format, batch), func(b *testing.B) {
+				stdout := &countingWriter{}
+				d := newTestEnumerator(b, nil, func(config *DNSConfig) {
+					config.StdoutFormat = format
+					config.Stdout = stdout
+					config.BatchSize = batch
+				})
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					d.WriteOutput(result)
+				}
+				b.StopTimer()
+				d.flushSinks()
+				b.ReportMetric(float64(stdout.writes)/float64(b.N), "writes/op")
+			})
+		}
+	}
+}
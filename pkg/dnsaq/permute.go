@@ -0,0 +1,245 @@
+package dnsaq
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GeneratePermutations streams altdns-style mutations of known subdomains
+// to yield: for each known name and wordlist entry, word-known, known-word
+// and word.known on the first label, plus numeric increments of that label
+// (api -> api1, api2; api7 -> api6, api8). It stops early when yield
+// returns false. Output is deterministic and free of duplicates and of the
+// known names themselves. Duplicates are avoided by construction rather
+// than by remembering what was generated, so memory depends on the input
+// lists only, however many candidates they make.
+func GeneratePermutations(knowns, words []string, yield func(string) bool) {
+	p := newPermuter(knowns, words)
+	emit := func(candidate string, at permPos) bool {
+		if p.input[candidate] || p.madeBefore(candidate, at) {
+			return true
+		}
+		return yield(candidate)
+	}
+
+	for k, known := range p.knowns {
+		label, parent, _ := strings.Cut(known, ".")
+
+		for i, increment := range numericIncrements(label) {
+			if !emit(increment+"."+parent, permPos{k, i}) {
+				return
+			}
+		}
+		for w, word := range p.words {
+			for f, candidate := range []string{
+				word + "-" + label + "." + parent,
+				label + "-" + word + "." + parent,
+				word + "." + known,
+			} {
+				if !emit(candidate, permPos{k, 2 + 3*w + f}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// permPos is where GeneratePermutations makes a candidate: the index of the
+// known name and the slot within its candidates, two increments and then
+// three forms per word
+type permPos struct {
+	known, slot int
+}
+
+func (p permPos) before(q permPos) bool {
+	return p.known < q.known || (p.known == q.known && p.slot < q.slot)
+}
+
+// permuter holds the deduplicated inputs of GeneratePermutations, indexed so
+// that every way of making a candidate can be looked up
+type permuter struct {
+	// knowns are the names with a parent to permute under, in input order
+	knowns    []string
+	knownName map[string]int
+	// input holds every known name, which is never a candidate
+	input     map[string]bool
+	words     []string
+	wordIndex map[string]int
+	// increments maps each numeric increment to where it is first made
+	increments map[string]permPos
+}
+
+func newPermuter(knowns, words []string) *permuter {
+	p := &permuter{
+		knownName:  make(map[string]int),
+		input:      make(map[string]bool, len(knowns)),
+		wordIndex:  make(map[string]int),
+		increments: make(map[string]permPos),
+	}
+	for _, known := range knowns {
+		p.input[known] = true
+		if _, seen := p.knownName[known]; !seen && strings.Contains(known, ".") {
+			p.knownName[known] = len(p.knowns)
+			p.knowns = append(p.knowns, known)
+		}
+	}
+	for _, word := range words {
+		if _, seen := p.wordIndex[word]; !seen {
+			p.wordIndex[word] = len(p.words)
+			p.words = append(p.words, word)
+		}
+	}
+	for k, known := range p.knowns {
+		label, parent, _ := strings.Cut(known, ".")
+		for i, increment := range numericIncrements(label) {
+			candidate := increment + "." + parent
+			if _, seen := p.increments[candidate]; !seen {
+				p.increments[candidate] = permPos{k, i}
+			}
+		}
+	}
+	return p
+}
+
+// madeBefore reports whether GeneratePermutations also makes candidate
+// somewhere before at. Words may hold dots and hyphens, so every split of
+// the candidate into a word and a known name is tried: word.known,
+// word-known (word-label.parent) and label-word.parent.
+func (p *permuter) madeBefore(candidate string, at permPos) bool {
+	made := func(known, word string, form int) bool {
+		k, ok := p.knownName[known]
+		if !ok {
+			return false
+		}
+		w, ok := p.wordIndex[word]
+		return ok && (permPos{k, 2 + 3*w + form}).before(at)
+	}
+
+	if pos, ok := p.increments[candidate]; ok && pos.before(at) {
+		return true
+	}
+	for i := 0; i < len(candidate); i++ {
+		switch candidate[i] {
+		case '.':
+			if made(candidate[i+1:], candidate[:i], 2) {
+				return true
+			}
+		case '-':
+			if made(candidate[i+1:], candidate[:i], 0) {
+				return true
+			}
+			// label-word.parent, where the label is everything before this
+			// hyphen and has no dot
+			label := candidate[:i]
+			if strings.Contains(label, ".") {
+				continue
+			}
+			rest := candidate[i+1:]
+			for j := 0; j < len(rest); j++ {
+				if rest[j] == '.' && made(label+rest[j:], rest[:j], 1) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// numericIncrements returns the neighbours of a label's trailing number, or
+// the label numbered 1 and 2 when it has none
+func numericIncrements(label string) []string {
+	stem := strings.TrimRight(label, "0123456789")
+	if stem == label {
+		return []string{label + "1", label + "2"}
+	}
+
+	n, err := strconv.Atoi(label[len(stem):])
+	if err != nil {
+		return nil
+	}
+	increments := []string{stem + strconv.Itoa(n+1)}
+	if n > 0 {
+		increments = append([]string{stem + strconv.Itoa(n-1)}, increments...)
+	}
+	return increments
+}
+
+// readNames reads one lower-cased name per line, without trailing dots
+func readNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := newLineReader(r)
+	for scanner.Scan() {
+		names = append(names, strings.ToLower(strings.TrimSuffix(scanner.Text(), ".")))
+	}
+	return names, scanner.Err()
+}
+
+// Permute resolves the permutations of the known subdomains read from
+// input, built with the words of the wordlist, until they are exhausted or
+// ctx is cancelled
+func (d *DNSEnumerator) Permute(ctx context.Context, input *bufio.Reader, wordlistPath string) {
+	defer d.stopWith(ctx)()
+
+	knowns, err := readNames(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		return
+	}
+
+	file, err := openInput(wordlistPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening wordlist: %v\n", err)
+		return
+	}
+	words, err := readNames(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+		return
+	}
+
+	results := d.newResults()
+	written := make(chan struct{})
+
+	// Process results
+	go d.writeResults(results, written)
+	stopProgress := d.startProgress()
+
+	pool := d.newWorkerPool()
+	GeneratePermutations(knowns, words, func(candidate string) bool {
+		candidate, err := asciiName(candidate)
+		if err != nil {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Skipping permutation: %v\n", err)
+			}
+			return true
+		}
+		if !d.validName(candidate) {
+			return true
+		}
+		d.startWildcardChecks(candidate)
+		if d.stopped() {
+			return false
+		}
+		if d.alreadyDone(candidate) {
+			return true
+		}
+		d.wait()
+		pool.Submit(func() {
+			d.ProcessDomain(candidate, results)
+			d.markDone(candidate)
+		})
+		return true
+	})
+
+	pool.Wait()
+	close(results)
+	<-written
+	stopProgress()
+	d.reportRun()
+}
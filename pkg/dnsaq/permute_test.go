@@ -0,0 +1,163 @@
+package dnsaq
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// collectPermutations gathers the candidates of GeneratePermutations
+func collectPermutations(knowns, words []string) []string {
+	var candidates []string
+	GeneratePermutations(knowns, words, func(candidate string) bool {
+		candidates = append(candidates, candidate)
+		return true
+	})
+	return candidates
+}
+
+// rememberedPermutations is the straightforward generator, deduplicating
+// with a set of everything made so far, to check GeneratePermutations
+// against
+func rememberedPermutations(knowns, words []string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, known := range knowns {
+		seen[known] = true
+	}
+	emit := func(candidate string) {
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	for _, known := range knowns {
+		label, parent, ok := strings.Cut(known, ".")
+		if !ok {
+			continue
+		}
+		for _, increment := range numericIncrements(label) {
+			emit(increment + "." + parent)
+		}
+		for _, word := range words {
+			emit(word + "-" + label + "." + parent)
+			emit(label + "-" + word + "." + parent)
+			emit(word + "." + known)
+		}
+	}
+	return candidates
+}
+
+func TestGeneratePermutations(t *testing.T) {
+	got := collectPermutations([]string{"api.example.com"}, []string{"dev"})
+	want := []string{
+		"api1.example.com", "api2.example.com",
+		"dev-api.example.com", "api-dev.example.com", "dev.api.example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GeneratePermutations = %v, want %v", got, want)
+	}
+}
+
+func TestGeneratePermutationsDeduplicates(t *testing.T) {
+	tests := []struct {
+		name          string
+		knowns, words []string
+	}{
+		{"repeated inputs", []string{"api.x.com", "api.x.com"}, []string{"dev", "dev"}},
+		{"candidate is known", []string{"api.x.com", "dev-api.x.com", "api1.x.com"}, []string{"dev"}},
+		{"word matches label", []string{"a.x.com"}, []string{"a"}},
+		{"hyphenated words", []string{"a.x.com", "x.com"}, []string{"b-a", "a-b", "b"}},
+		{"dotted words", []string{"a.x.com", "x.com", "c.a.x.com"}, []string{"b.a", "c", "b"}},
+		{"increments meet words", []string{"api7.x.com", "api9.x.com", "api.x.com"}, []string{"8", "api8"}},
+		{"no parent", []string{"localhost", "api.localhost"}, []string{"dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectPermutations(tt.knowns, tt.words)
+			if want := rememberedPermutations(tt.knowns, tt.words); !reflect.DeepEqual(got, want) {
+				t.Errorf("GeneratePermutations = %v, want %v", got, want)
+			}
+		})
+	}
+
+	// Random names built from a tiny alphabet collide in every way the forms allow
+	rng := rand.New(rand.NewSource(1))
+	name := func(parts int) string {
+		labels := make([]string, parts)
+		for i := range labels {
+			labels[i] = []string{"a", "b", "a-b", "b-a", "a1", "a2", "1"}[rng.Intn(7)]
+		}
+		return strings.Join(labels, ".")
+	}
+	for i := 0; i < 500; i++ {
+		var knowns, words []string
+		for j := rng.Intn(6); j >= 0; j-- {
+			knowns = append(knowns, name(1+rng.Intn(3)))
+		}
+		for j := rng.Intn(6); j >= 0; j-- {
+			words = append(words, name(1+rng.Intn(2)))
+		}
+		got := collectPermutations(knowns, words)
+		if want := rememberedPermutations(knowns, words); !reflect.DeepEqual(got, want) {
+			t.Fatalf("knowns %q, words %q:\ngot  %v\nwant %v", knowns, words, got, want)
+		}
+	}
+}
+
+func TestGeneratePermutationsStopsEarly(t *testing.T) {
+	n := 0
+	GeneratePermutations([]string{"api.example.com"}, []string{"a", "b", "c"}, func(string) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("yield called %d times after returning false, want 3", n)
+	}
+}
+
+func TestGeneratePermutationsMemoryStaysFlat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates millions of candidates")
+	}
+
+	var knowns, words []string
+	for i := 0; i < 200; i++ {
+		knowns = append(knowns, "www.site"+strconv.Itoa(i)+".example.com")
+	}
+	for i := 0; i < 10000; i++ {
+		words = append(words, "word"+strconv.Itoa(i))
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapAlloc
+
+	// Six million candidates; keeping them, or a set of them, takes
+	// hundreds of megabytes
+	var count int
+	var peak uint64
+	GeneratePermutations(knowns, words, func(string) bool {
+		count++
+		if count%500000 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		return true
+	})
+
+	// Two increments and three forms per word, none of them colliding
+	if want := len(knowns) * (2 + 3*len(words)); count != want {
+		t.Errorf("generated %d candidates, want %d", count, want)
+	}
+	if peak > baseline && peak-baseline > 16<<20 {
+		t.Errorf("heap grew by %d MB while generating, want it flat", (peak-baseline)>>20)
+	}
+}
@@ -0,0 +1,79 @@
+package dnsaq
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// workerPool runs jobs on a fixed set of goroutines, so the number of
+// lookups in flight stays bounded however long the input is
+type workerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+// newWorkerPool starts -concurrency workers. Each job holds one of the
+// enumerator's slots while it runs, which it shares with wildcard probes.
+func (d *DNSEnumerator) newWorkerPool() *workerPool {
+	workers := d.Config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := &workerPool{jobs: make(chan func())}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				d.slots <- struct{}{}
+				job()
+				<-d.slots
+				atomic.AddInt64(&d.stats.Processed, 1)
+			}
+		}()
+	}
+	return pool
+}
+
+// fanOut runs job(0) to job(n-1) concurrently within the -concurrency
+// budget. Each job but the last gets a goroutine of its own when a slot is
+// free and runs on the caller otherwise; the last always runs on the
+// caller, which is expected to hold a slot already. All jobs but the first
+// wait on the rate limiter.
+func (d *DNSEnumerator) fanOut(n int, job func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.wait()
+		}
+		if i < n-1 {
+			select {
+			case d.slots <- struct{}{}:
+				wg.Add(1)
+				go func(i int) {
+					defer func() {
+						<-d.slots
+						wg.Done()
+					}()
+					job(i)
+				}(i)
+				continue
+			default:
+			}
+		}
+		job(i)
+	}
+	wg.Wait()
+}
+
+// Submit hands a job to the next idle worker, blocking while all are busy
+func (p *workerPool) Submit(job func()) {
+	p.jobs <- job
+}
+
+// Wait stops accepting jobs and returns once every submitted job has finished
+func (p *workerPool) Wait() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package dnsaq
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often -progress reports
+const progressInterval = 2 * time.Second
+
+// showProgress reports whether progress is reported, under -progress or -v
+func (d *DNSEnumerator) showProgress() bool {
+	return d.Config.Progress || d.Config.Verbose
+}
+
+// startProgress prints a progress line to stderr every progressInterval
+// under -progress or -v, until the returned function is called. On a
+// terminal the line is redrawn in place.
+func (d *DNSEnumerator) startProgress() (stop func()) {
+	if !d.showProgress() {
+		return func() {}
+	}
+
+	stat, err := os.Stderr.Stat()
+	tty := err == nil && stat.Mode()&os.ModeCharDevice != 0
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		printed := false
+		lastQueries, lastTick := atomic.LoadInt64(&d.stats.Queries), time.Now()
+		for {
+			select {
+			case <-done:
+				if printed && tty {
+					fmt.Fprintln(os.Stderr)
+				}
+				return
+			case now := <-ticker.C:
+				queries := atomic.LoadInt64(&d.stats.Queries)
+				qps := float64(queries-lastQueries) / now.Sub(lastTick).Seconds()
+				lastQueries, lastTick = queries, now
+
+				line := d.progressLine(qps)
+				if tty {
+					fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+				} else {
+					fmt.Fprintln(os.Stderr, line)
+				}
+				printed = true
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// progressLine renders the current progress, e.g.
+// "Progress: 1200/50000 names (2.4%), 250.0 queries/s, 13 found"
+func (d *DNSEnumerator) progressLine(qps float64) string {
+	processed := atomic.LoadInt64(&d.stats.Processed)
+	found := atomic.LoadInt64(&d.stats.Resolved)
+
+	names := fmt.Sprintf("%d names", processed)
+	if total := atomic.LoadInt64(&d.progressTotal); total > 0 {
+		names = fmt.Sprintf("%d/%d names (%.1f%%)", processed, total, float64(processed)*100/float64(total))
+	}
+	return fmt.Sprintf("Progress: %s, %.1f queries/s, %d found", names, qps, found)
+}
+
+// countLines counts the usable lines of a wordlist, for the progress total
+func countLines(r io.Reader) int64 {
+	var n int64
+	scanner := newLineReader(r)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,36 @@
+package dnsaq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestBruteforceCountsWordlistOnlyForProgress(t *testing.T) {
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("www\nmail\napi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, progress := range []bool{false, true} {
+		server := newMockServer(t, rcodeHandler(dns.RcodeNameError))
+		d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+			config.Progress = progress
+		})
+		d.Bruteforce(context.Background(), "example.test", wordlist)
+
+		want := int64(0)
+		if progress {
+			want = 3
+		}
+		if d.progressTotal != want {
+			t.Errorf("with Progress %v, progress total = %d, want %d", progress, d.progressTotal, want)
+		}
+		if got := len(server.Queries()); got != 3 {
+			t.Errorf("with Progress %v, resolver got %d queries, want 3", progress, got)
+		}
+	}
+}
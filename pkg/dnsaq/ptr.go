@@ -0,0 +1,49 @@
+package dnsaq
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// processPTR looks up the host names of an IPv4 or IPv6 address for -ptr
+// mode. Lines that are not addresses are skipped.
+func (d *DNSEnumerator) processPTR(ip string, results chan<- Result) {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Skipping %q: not an IP address\n", ip)
+		}
+		return
+	}
+
+	answer, err := d.Lookup(arpa, dns.TypePTR)
+	if err != nil {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", ip, err)
+		}
+		return
+	}
+	if answer.NoData {
+		return
+	}
+
+	atomic.AddInt64(&d.stats.Resolved, 1)
+	d.sendResult(results, Result{
+		Domain:    ip,
+		Type:      dns.TypeToString[dns.TypePTR],
+		Records:   d.capAnswers(answer.Records),
+		Resolver:  answer.Resolver,
+		RTT:       milliseconds(answer.RTT),
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// isIP reports whether s is an IPv4 or IPv6 address
+func isIP(s string) bool {
+	return net.ParseIP(s) != nil
+}
@@ -0,0 +1,56 @@
+package dnsaq
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// queryLogEntry is one line of the -query-log audit trail
+type queryLogEntry struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Resolver string    `json:"resolver"`
+	Rcode    string    `json:"rcode"`
+	RTT      float64   `json:"rtt_ms"`
+	Answers  int       `json:"answers"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// logQuery appends a query to the query log. Each entry is a single write
+// under the mutex, so lines never interleave.
+func (d *DNSEnumerator) logQuery(msg *dns.Msg, resolver string, resp *dns.Msg, rtt time.Duration, err error) {
+	entry := queryLogEntry{
+		Time:     time.Now().UTC(),
+		Name:     msg.Question[0].Name,
+		Type:     dns.TypeToString[msg.Question[0].Qtype],
+		Resolver: resolver,
+		Rcode:    "ERROR",
+		RTT:      milliseconds(rtt),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Rcode = dns.RcodeToString[resp.Rcode]
+		entry.Answers = len(resp.Answer)
+	}
+
+	var line string
+	if d.Config.QueryLogJSON {
+		encoded, _ := json.Marshal(entry)
+		line = string(encoded)
+	} else {
+		line = fmt.Sprintf("%s %s %s %s %s %.1fms answers=%d",
+			entry.Time.Format(time.RFC3339Nano), entry.Name, entry.Type, entry.Resolver, entry.Rcode, entry.RTT, entry.Answers)
+		if entry.Error != "" {
+			line += fmt.Sprintf(" error=%q", entry.Error)
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.queryLog.WriteString(line + "\n")
+}
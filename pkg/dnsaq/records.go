@@ -0,0 +1,83 @@
+package dnsaq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SupportedRecordTypes lists the query types whose answers we know how to render
+var SupportedRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "PTR", "SOA", "SRV", "TXT", "CAA", "NAPTR"}
+
+// ParseRecordType maps a record type name such as "MX" to its dns.Type value.
+// Unknown or unsupported names are rejected so a typo never turns into a type 0 query.
+func ParseRecordType(name string) (uint16, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, supported := range SupportedRecordTypes {
+		if name == supported {
+			return dns.StringToType[name], nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported record type %q (supported: %s)", name, strings.Join(SupportedRecordTypes, ", "))
+}
+
+// ParseQueryClass maps a -class name to its dns.Class value: IN, or CH
+// (also spelt CHAOS) for server diagnostics such as version.bind
+func ParseQueryClass(name string) (uint16, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "IN":
+		return dns.ClassINET, nil
+	case "CH", "CHAOS":
+		return dns.ClassCHAOS, nil
+	}
+	return 0, fmt.Errorf("unsupported query class %q (supported: IN, CH)", name)
+}
+
+// ParseRecordTypes parses a comma-separated list of record type names such as
+// "A,AAAA,MX". Duplicates are dropped and the order is kept.
+func ParseRecordTypes(list string) ([]uint16, error) {
+	var qtypes []uint16
+	seen := make(map[uint16]bool)
+	for _, name := range strings.Split(list, ",") {
+		qtype, err := ParseRecordType(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[qtype] {
+			seen[qtype] = true
+			qtypes = append(qtypes, qtype)
+		}
+	}
+	return qtypes, nil
+}
+
+// recordValue renders the data portion of an answer record
+func recordValue(rr dns.RR) string {
+	switch r := rr.(type) {
+	case *dns.A:
+		return r.A.String()
+	case *dns.AAAA:
+		return r.AAAA.String()
+	case *dns.CNAME:
+		return r.Target
+	case *dns.MX:
+		return fmt.Sprintf("%d %s", r.Preference, r.Mx)
+	case *dns.NS:
+		return r.Ns
+	case *dns.PTR:
+		return r.Ptr
+	case *dns.SOA:
+		return fmt.Sprintf("%s %s %d", r.Ns, r.Mbox, r.Serial)
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target)
+	case *dns.TXT:
+		return strings.Join(r.Txt, "")
+	case *dns.CAA:
+		return fmt.Sprintf("%d %s %q", r.Flag, r.Tag, r.Value)
+	case *dns.NAPTR:
+		return fmt.Sprintf("%d %d %q %q %q %s", r.Order, r.Preference, r.Flags, r.Service, r.Regexp, r.Replacement)
+	}
+	// Fall back to the presentation format without the header
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
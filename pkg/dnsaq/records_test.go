@@ -0,0 +1,18 @@
+package dnsaq
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseQueryClass(t *testing.T) {
+	for name, want := range map[string]uint16{"IN": dns.ClassINET, "in": dns.ClassINET, "CH": dns.ClassCHAOS, " chaos ": dns.ClassCHAOS} {
+		if got, err := ParseQueryClass(name); err != nil || got != want {
+			t.Errorf("ParseQueryClass(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseQueryClass("HS"); err == nil {
+		t.Error("ParseQueryClass accepted HS")
+	}
+}
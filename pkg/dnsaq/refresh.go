@@ -0,0 +1,135 @@
+package dnsaq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Refresh reads a previous JSON Lines result file and re-resolves only the
+// entries whose timestamp is older than maxAge. Fresh entries are carried
+// forward unchanged, so a periodic refresh of a large dataset only costs
+// queries for what has gone stale. Stale names that no longer resolve drop
+// out of the output. The refresh stops early when ctx is cancelled.
+func (d *DNSEnumerator) Refresh(ctx context.Context, path string, maxAge time.Duration) {
+	defer d.stopWith(ctx)()
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening refresh file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	results := d.newResults()
+	written := make(chan struct{})
+
+	// Process results
+	go d.writeResults(results, written)
+	stopProgress := d.startProgress()
+
+	cutoff := time.Now().Add(-maxAge)
+	var carried, stale int
+	// -mx and -srv lookups write a row per server, but one lookup refreshes them all
+	requeried := make(map[string]bool)
+
+	pool := d.newWorkerPool()
+	decoder := json.NewDecoder(file)
+	for !d.stopped() {
+		var previous Result
+		if err := decoder.Decode(&previous); err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Error reading refresh file: %v\n", err)
+			}
+			break
+		}
+
+		// A carried entry with records is still a resolved name, which
+		// -fail-on-empty counts; NXDOMAIN, NODATA and ERROR entries are not
+		if previous.Timestamp.After(cutoff) {
+			carried++
+			if len(previous.Records) > 0 && previous.Status == "" {
+				atomic.AddInt64(&d.stats.Resolved, 1)
+			}
+			d.sendResult(results, previous)
+			continue
+		}
+
+		// Output shows internationalized names in Unicode; query their A-labels
+		ascii, err := asciiName(previous.Domain)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %q: %v\n", previous.Domain, err)
+			continue
+		}
+		previous.Domain = ascii
+
+		key := previous.Domain + " " + previous.Type
+		if previous.MX != nil || previous.SRV != nil {
+			if requeried[key] {
+				continue
+			}
+			requeried[key] = true
+		}
+
+		stale++
+		if !isIP(previous.Domain) {
+			d.startWildcardChecks(previous.Domain)
+		}
+		d.wait()
+		pool.Submit(func() {
+			d.refreshResult(previous, results)
+		})
+	}
+
+	pool.Wait()
+	close(results)
+	<-written
+	stopProgress()
+	d.reportRun()
+
+	if d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Refresh: %d entries carried forward, %d re-resolved\n", carried, stale)
+	}
+}
+
+// refreshResult re-resolves a stale entry the way it was originally
+// found: -discover, -mx and -srv entries by their mode, the rest with the
+// record type they were queried with
+func (d *DNSEnumerator) refreshResult(previous Result, results chan<- Result) {
+	switch {
+	case previous.Inventory != nil:
+		d.processDiscover(previous.Domain, results)
+		return
+	case previous.MX != nil:
+		d.processMX(previous.Domain, results)
+		return
+	case previous.SRV != nil:
+		// The entry names one service, so only that service is looked up again
+		if d.processService(previous.Domain, results) {
+			atomic.AddInt64(&d.stats.Resolved, 1)
+		}
+		return
+	}
+
+	qtype := d.Config.QueryType
+	if previous.Type != "" {
+		parsed, err := ParseRecordType(strings.TrimSpace(previous.Type))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Refreshing %s with -type: %v\n", previous.Domain, err)
+		} else {
+			qtype = parsed
+		}
+	}
+	if qtype == dns.TypePTR && isIP(previous.Domain) {
+		d.processPTR(previous.Domain, results)
+		return
+	}
+	d.ProcessQuery(previous.Domain, qtype, QueryFlags{}, results)
+}
@@ -0,0 +1,95 @@
+package dnsaq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRefreshCountsCarriedEntriesAsResolved(t *testing.T) {
+	server := newMockServer(t, rcodeHandler(0))
+	d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+	stamp := time.Now().Format(time.RFC3339)
+	previous := `{"domain":"www.example.test","records":["192.0.2.1"],"timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"mail.example.test","records":["192.0.2.2"],"timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"gone.example.test","status":"NXDOMAIN","timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"empty.example.test","status":"NODATA","timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"broken.example.test","status":"ERROR","timestamp":"` + stamp + `"}` + "\n"
+	path := filepath.Join(t.TempDir(), "previous.json")
+	if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Refresh(context.Background(), path, time.Hour)
+
+	if got := d.Resolved(); got != 2 {
+		t.Errorf("Resolved = %d after carrying two fresh answers and three fresh misses, want 2", got)
+	}
+	if got := len(server.Queries()); got != 0 {
+		t.Errorf("resolver got %d queries for fresh entries, want 0", got)
+	}
+}
+
+func TestRefreshRequeriesMXAndSRVByMode(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"example.test. MX": {
+			"example.test. 60 IN MX 10 mx1.example.test.",
+			"example.test. 60 IN MX 20 mx2.example.test.",
+		},
+		"_sip._tcp.example.test. SRV": {"_sip._tcp.example.test. 60 IN SRV 0 100 5060 sip.example.test."},
+		"sip.example.test. A":         {"sip.example.test. 60 IN A 192.0.2.5"},
+	}))
+	var stdout bytes.Buffer
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.StdoutFormat = FormatJSON
+		config.Stdout = &stdout
+	})
+
+	// Both servers of example.test were written by one -mx lookup
+	stamp := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	previous := `{"domain":"example.test","type":"MX","mx":{"preference":10,"host":"mx1.example.test"},"timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"example.test","type":"MX","mx":{"preference":20,"host":"mx2.example.test"},"timestamp":"` + stamp + `"}` + "\n" +
+		`{"domain":"_sip._tcp.example.test","type":"SRV","srv":{"priority":0,"weight":100,"port":5060,"target":"sip.example.test"},"timestamp":"` + stamp + `"}` + "\n"
+	path := filepath.Join(t.TempDir(), "previous.json")
+	if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Refresh(context.Background(), path, time.Hour)
+	d.Close()
+
+	var mx, srv int
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var result Result
+		if err := decoder.Decode(&result); err != nil {
+			break
+		}
+		switch {
+		case result.MX != nil:
+			mx++
+		case result.SRV != nil && len(result.Records) == 1:
+			srv++
+		default:
+			t.Errorf("refreshed entry %+v lost its MX or SRV fields", result)
+		}
+	}
+	if mx != 2 || srv != 1 {
+		t.Errorf("refresh wrote %d MX and %d SRV entries, want 2 and 1", mx, srv)
+	}
+	for _, query := range server.Queries() {
+		if qtype := query.Question.Qtype; qtype != dns.TypeMX && qtype != dns.TypeSRV && qtype != dns.TypeA {
+			t.Errorf("refresh sent a %s query for %s", dns.TypeToString[qtype], query.Question.Name)
+		}
+	}
+	if got := d.Resolved(); got != 2 {
+		t.Errorf("Resolved = %d, want the domain and the service", got)
+	}
+}
@@ -0,0 +1,86 @@
+package dnsaq
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// resumeState is the -resume record of names already processed. Names are
+// appended as their lookups finish and flushed with the output sinks, so an
+// interrupted run loses at most the last second of progress.
+type resumeState struct {
+	done   map[string]bool
+	file   *os.File
+	writer *bufio.Writer
+	// skipped counts names passed over because an earlier run finished them
+	skipped int64
+}
+
+// openResumeState loads the names recorded in path, creating the file if
+// needed, and keeps it open for appending
+func openResumeState(path string) (*resumeState, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool)
+	scanner := newLineReader(file)
+	for scanner.Scan() {
+		done[scanner.Text()] = true
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &resumeState{done: done, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// resumeKey is how a name is recorded in the resume file
+func resumeKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// alreadyDone reports whether -resume recorded name as processed by an
+// earlier run, so it can be skipped before any query is spent on it
+func (d *DNSEnumerator) alreadyDone(name string) bool {
+	if d.resume == nil {
+		return false
+	}
+	d.mutex.Lock()
+	done := d.resume.done[resumeKey(name)]
+	d.mutex.Unlock()
+	if done {
+		atomic.AddInt64(&d.resume.skipped, 1)
+	}
+	return done
+}
+
+// markDone records name as processed, whether or not it resolved. Lookups
+// cut short by a stopped run are left out so the next run retries them.
+func (d *DNSEnumerator) markDone(name string) {
+	// A -dry-run has looked nothing up yet
+	if d.resume == nil || d.stopped() || d.Config.DryRun {
+		return
+	}
+	key := resumeKey(name)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.resume.done[key] {
+		d.resume.done[key] = true
+		d.resume.writer.WriteString(key + "\n")
+	}
+}
+
+// reportResume prints how many names -resume skipped
+func (d *DNSEnumerator) reportResume() {
+	if d.resume == nil {
+		return
+	}
+	if skipped := atomic.LoadInt64(&d.resume.skipped); skipped > 0 && !d.quiet() {
+		fmt.Fprintf(os.Stderr, "Resumed: skipped %d names processed by an earlier run\n", skipped)
+	}
+}
@@ -0,0 +1,56 @@
+package dnsaq
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Retry backoff doubles from retryBaseDelay on every attempt, up to retryMaxDelay
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// retryDelay returns how long to wait before the given retry attempt (1-based).
+// Jitter takes a random share of up to -retry-jitter off the exponential
+// delay so workers that failed together don't retry together and hit a
+// struggling resolver in synchronized waves.
+func (d *DNSEnumerator) retryDelay(attempt int) time.Duration {
+	delay := backoff(attempt)
+	if jitter := d.Config.RetryJitter; jitter > 0 {
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// backoff is the exponential delay before a retry attempt, before jitter
+func backoff(attempt int) time.Duration {
+	if shift := attempt - 1; shift < 16 && retryBaseDelay<<shift < retryMaxDelay {
+		return retryBaseDelay << shift
+	}
+	return retryMaxDelay
+}
+
+// LookupBudget is the longest one lookup can take when nothing answers: a
+// dial and a query timeout for every resolver on every attempt, plus the
+// backoff between attempts. Re-asking truncated answers over TCP and
+// chasing CNAMEs can add to it.
+func (d *DNSEnumerator) LookupBudget() time.Duration {
+	perAttempt := time.Duration(len(d.Config.Resolvers)) * (dialTimeout(d.Config) + d.Config.Timeout)
+	budget := time.Duration(d.Config.Retries+1) * perAttempt
+	for attempt := 1; attempt <= d.Config.Retries; attempt++ {
+		budget += backoff(attempt)
+	}
+	return budget
+}
+
+// retryable reports whether a failed exchange may succeed on another pass.
+// Timeouts and other network errors are transient; anything else, such as a
+// query that cannot be packed or a reply that cannot be parsed, fails the
+// same way every time.
+func retryable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
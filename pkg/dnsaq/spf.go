@@ -0,0 +1,223 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// spfLookupLimit is the RFC 7208 cap on DNS-querying mechanisms an SPF
+// evaluation may use; receivers treat records needing more as a permerror
+const spfLookupLimit = 10
+
+// MailPolicy is the flattened SPF record and the DMARC policy of a domain
+// as reported by -spf
+type MailPolicy struct {
+	// SPF is the domain's own SPF record
+	SPF string `json:"spf,omitempty"`
+	// Lookups counts the DNS-querying mechanisms the SPF record needed
+	Lookups int `json:"spf_lookups"`
+	// Unresolved lists mechanisms that were not expanded, because the
+	// lookup limit was reached or they cannot be flattened (ptr, exists)
+	Unresolved []string `json:"spf_unresolved,omitempty"`
+	// DMARC is the _dmarc record and Policy its p= tag
+	DMARC  string `json:"dmarc,omitempty"`
+	Policy string `json:"dmarc_policy,omitempty"`
+}
+
+// spfExpansion carries the state of one SPF flattening
+type spfExpansion struct {
+	policy  *MailPolicy
+	senders []string
+	seen    map[string]bool
+	visited map[string]bool
+}
+
+// processSPF flattens the SPF record of a domain for -spf mode, following
+// include: and redirect= up to the RFC lookup limit, and reports it
+// together with the domain's DMARC policy. Records holds the authorized
+// senders as ip4:/ip6: mechanisms.
+func (d *DNSEnumerator) processSPF(domain string, results chan<- Result) {
+	domain = strings.TrimSuffix(domain, ".")
+	expansion := &spfExpansion{
+		policy:  &MailPolicy{},
+		seen:    make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+
+	record, err := d.spfRecord(domain)
+	if err != nil && d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Error resolving %s TXT: %v\n", domain, err)
+	}
+	if record != "" {
+		expansion.policy.SPF = record
+		d.expandSPF(domain, record, expansion)
+	}
+	if expansion.policy.Lookups > spfLookupLimit {
+		fmt.Fprintf(os.Stderr, "[!] SPF record of %s needs %d DNS lookups, more than the limit of %d; receivers will reject it\n",
+			domain, expansion.policy.Lookups, spfLookupLimit)
+	}
+
+	d.wait()
+	if records, err := d.ResolveType("_dmarc."+domain, dns.TypeTXT); err == nil {
+		for _, txt := range records {
+			if strings.HasPrefix(txt, "v=DMARC1") {
+				expansion.policy.DMARC = txt
+				expansion.policy.Policy = dmarcTag(txt, "p")
+				break
+			}
+		}
+	}
+
+	if expansion.policy.SPF == "" && expansion.policy.DMARC == "" {
+		if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "No SPF or DMARC record for %s\n", domain)
+		}
+		return
+	}
+	atomic.AddInt64(&d.stats.Resolved, 1)
+	d.sendResult(results, Result{
+		Domain:    domain,
+		Type:      "SPF",
+		Records:   expansion.senders,
+		Mail:      expansion.policy,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// spfRecord returns the v=spf1 TXT record of domain, if it has one
+func (d *DNSEnumerator) spfRecord(domain string) (string, error) {
+	records, err := d.ResolveType(domain, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+	for _, txt := range records {
+		if txt == "v=spf1" || strings.HasPrefix(strings.ToLower(txt), "v=spf1 ") {
+			return txt, nil
+		}
+	}
+	return "", nil
+}
+
+// expandSPF walks the mechanisms of one SPF record, collecting the senders
+// it authorizes. Every mechanism that costs a DNS lookup is counted, and
+// none is expanded once the limit is used up.
+func (d *DNSEnumerator) expandSPF(domain, record string, expansion *spfExpansion) {
+	if expansion.visited[domain] {
+		return
+	}
+	expansion.visited[domain] = true
+
+	var redirect string
+	for _, term := range strings.Fields(record)[1:] {
+		// Only pass mechanisms authorize anyone; -, ~ and ? ones are skipped,
+		// as is a bare qualifier with no mechanism after it
+		mechanism := strings.TrimPrefix(term, "+")
+		if mechanism == "" || strings.ContainsAny(mechanism[:1], "-~?") {
+			continue
+		}
+
+		name, value, _ := strings.Cut(mechanism, ":")
+		name = strings.ToLower(name)
+		switch {
+		case name == "ip4" || name == "ip6":
+			expansion.addSender(mechanism)
+		case name == "include":
+			if d.spfLookup(term, expansion) {
+				d.wait()
+				if included, err := d.spfRecord(value); err == nil && included != "" {
+					d.expandSPF(value, included, expansion)
+				}
+			}
+		case strings.HasPrefix(name, "redirect="):
+			redirect = mechanism[len("redirect="):]
+		case name == "a" || strings.HasPrefix(name, "a/") || name == "mx" || strings.HasPrefix(name, "mx/"):
+			if d.spfLookup(term, expansion) {
+				d.expandAddressMechanism(domain, name, value, expansion)
+			}
+		case name == "ptr" || name == "exists":
+			if d.spfLookup(term, expansion) {
+				expansion.policy.Unresolved = append(expansion.policy.Unresolved, term)
+			}
+		}
+	}
+
+	// redirect= only applies once the record's own mechanisms are exhausted
+	if redirect != "" && d.spfLookup("redirect="+redirect, expansion) {
+		d.wait()
+		if target, err := d.spfRecord(redirect); err == nil && target != "" {
+			d.expandSPF(redirect, target, expansion)
+		}
+	}
+}
+
+// expandAddressMechanism flattens an a or mx mechanism into the addresses
+// it authorizes
+func (d *DNSEnumerator) expandAddressMechanism(domain, name, value string, expansion *spfExpansion) {
+	// Any CIDR length is dropped; the addresses themselves are listed
+	target := domain
+	if value, _, _ = strings.Cut(value, "/"); value != "" {
+		target = value
+	}
+	hosts := []string{target}
+	if strings.HasPrefix(name, "mx") {
+		d.wait()
+		answer, err := d.Lookup(target, dns.TypeMX)
+		if err != nil {
+			return
+		}
+		hosts = nil
+		for _, host := range mxHosts(answer.RRs) {
+			hosts = append(hosts, host.Host)
+		}
+	}
+
+	for _, host := range hosts {
+		d.wait()
+		answer, err := d.lookupAddresses(host, QueryFlags{})
+		if err != nil {
+			continue
+		}
+		for _, addr := range answer.Records {
+			if strings.Contains(addr, ":") {
+				expansion.addSender("ip6:" + addr)
+			} else {
+				expansion.addSender("ip4:" + addr)
+			}
+		}
+	}
+}
+
+// spfLookup counts a mechanism that needs a DNS query, reporting whether it
+// is still within the lookup limit and may be expanded
+func (d *DNSEnumerator) spfLookup(term string, expansion *spfExpansion) bool {
+	expansion.policy.Lookups++
+	if expansion.policy.Lookups > spfLookupLimit {
+		expansion.policy.Unresolved = append(expansion.policy.Unresolved, term)
+		return false
+	}
+	return true
+}
+
+// addSender records an authorized sender once
+func (e *spfExpansion) addSender(sender string) {
+	if !e.seen[sender] {
+		e.seen[sender] = true
+		e.senders = append(e.senders, sender)
+	}
+}
+
+// dmarcTag returns the value of a tag in a DMARC record, e.g. "reject" for p
+func dmarcTag(record, tag string) string {
+	for _, part := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), tag) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
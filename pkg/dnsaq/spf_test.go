@@ -0,0 +1,56 @@
+package dnsaq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessSPF(t *testing.T) {
+	server := newMockServer(t, zoneHandler(map[string][]string{
+		"example.test. TXT":        {`example.test. 60 IN TXT "v=spf1 ip4:192.0.2.0/24 include:_spf.mail.test -ip4:198.51.100.1 -all"`},
+		"_spf.mail.test. TXT":      {`_spf.mail.test. 60 IN TXT "v=spf1 ip6:2001:db8::/32 ~all"`},
+		"_dmarc.example.test. TXT": {`_dmarc.example.test. 60 IN TXT "v=DMARC1; p=reject"`},
+		// A bare qualifier is malformed but must not stop the walk
+		"bare.test. TXT": {`bare.test. 60 IN TXT "v=spf1 + ip4:203.0.113.7 -all"`},
+	}))
+	d := newTestEnumerator(t, []string{server.Addr}, nil)
+
+	tests := []struct {
+		domain  string
+		senders []string
+		lookups int
+		policy  string
+	}{
+		{"example.test", []string{"ip4:192.0.2.0/24", "ip6:2001:db8::/32"}, 1, "reject"},
+		{"bare.test", []string{"ip4:203.0.113.7"}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			results := make(chan Result, 1)
+			d.processSPF(tt.domain, results)
+			close(results)
+			result, ok := <-results
+			if !ok {
+				t.Fatal("no result")
+			}
+			if !reflect.DeepEqual(result.Records, tt.senders) {
+				t.Errorf("senders = %v, want %v", result.Records, tt.senders)
+			}
+			if result.Mail.Lookups != tt.lookups || result.Mail.Policy != tt.policy {
+				t.Errorf("lookups %d, DMARC policy %q, want %d and %q", result.Mail.Lookups, result.Mail.Policy, tt.lookups, tt.policy)
+			}
+		})
+	}
+}
+
+func TestExpandSPFBareQualifier(t *testing.T) {
+	d := newTestEnumerator(t, nil, nil)
+	expansion := &spfExpansion{policy: &MailPolicy{}, seen: make(map[string]bool), visited: make(map[string]bool)}
+
+	// Used to panic slicing the empty mechanism left by stripping "+"
+	d.expandSPF("example.test", "v=spf1 + ip4:192.0.2.1 -all", expansion)
+
+	if want := []string{"ip4:192.0.2.1"}; !reflect.DeepEqual(expansion.senders, want) {
+		t.Errorf("senders = %v, want %v", expansion.senders, want)
+	}
+}
@@ -0,0 +1,127 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultSRVServices are the service prefixes -srv tries when no
+// -srv-services file is given: directory, VoIP, chat, mail, calendaring
+// and a few common application services
+var defaultSRVServices = []string{
+	"_ldap._tcp", "_ldaps._tcp", "_gc._tcp", "_ldap._tcp.dc._msdcs", "_kerberos._tcp", "_kerberos._udp", "_kpasswd._tcp", "_kpasswd._udp",
+	"_sip._tcp", "_sip._udp", "_sips._tcp", "_sip._tls", "_sipfederationtls._tcp", "_sipinternaltls._tcp", "_h323cs._tcp", "_stun._udp", "_turn._udp", "_turns._tcp",
+	"_xmpp-client._tcp", "_xmpp-server._tcp", "_jabber._tcp", "_matrix._tcp",
+	"_autodiscover._tcp", "_submission._tcp", "_submissions._tcp", "_imap._tcp", "_imaps._tcp", "_pop3._tcp", "_pop3s._tcp", "_smtp._tcp",
+	"_caldav._tcp", "_caldavs._tcp", "_carddav._tcp", "_carddavs._tcp",
+	"_http._tcp", "_https._tcp", "_ftp._tcp", "_ssh._tcp", "_vlmcs._tcp", "_mongodb._tcp", "_puppet._tcp", "_nfs._tcp", "_minecraft._tcp",
+}
+
+// SRVTarget is a server offering a service as reported by -srv
+type SRVTarget struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+// String renders the target as it appears in the record, e.g.
+// "0 100 389 dc01.example.com"
+func (t SRVTarget) String() string {
+	return fmt.Sprintf("%d %d %d %s", t.Priority, t.Weight, t.Port, t.Target)
+}
+
+// processSRV looks up every -srv service under domain, writing one result
+// per server with the server's addresses. The services are queried
+// concurrently within the -concurrency budget, pacing all but the first
+// through the rate limiter.
+func (d *DNSEnumerator) processSRV(domain string, results chan<- Result) {
+	domain = strings.TrimSuffix(domain, ".")
+	var found int32
+
+	d.fanOut(len(d.srvServices), func(i int) {
+		if d.stopped() {
+			return
+		}
+		if d.processService(d.srvServices[i]+"."+domain, results) {
+			atomic.StoreInt32(&found, 1)
+		}
+	})
+
+	if atomic.LoadInt32(&found) != 0 {
+		atomic.AddInt64(&d.stats.Resolved, 1)
+	} else if d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "No SRV records for any service under %s\n", domain)
+	}
+}
+
+// processService looks up the SRV records of one service name and reports
+// whether it has any servers
+func (d *DNSEnumerator) processService(name string, results chan<- Result) bool {
+	answer, err := d.Lookup(name, dns.TypeSRV)
+	if err != nil {
+		if d.Config.Verbose && !isNXDomain(err) {
+			fmt.Fprintf(os.Stderr, "Error resolving %s SRV: %v\n", name, err)
+		}
+		return false
+	}
+
+	targets := srvTargets(answer.RRs)
+	for _, target := range targets {
+		target := target
+		// A target of "." says the service is decidedly not available here
+		if target.Target == "." {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "%s is explicitly not offered\n", name)
+			}
+			continue
+		}
+
+		result := Result{
+			Domain:    name,
+			Type:      dns.TypeToString[dns.TypeSRV],
+			SRV:       &target,
+			Resolver:  answer.Resolver,
+			Timestamp: time.Now().UTC(),
+		}
+		d.wait()
+		if addresses, err := d.hostAddresses(target.Target); err == nil {
+			result.Records = d.capAnswers(addresses.Records)
+		} else if d.Config.Verbose {
+			fmt.Fprintf(os.Stderr, "Error resolving SRV target %s: %v\n", target.Target, err)
+		}
+		d.sendResult(results, result)
+	}
+	return len(targets) > 0
+}
+
+// srvTargets extracts the SRV records of an answer in priority order,
+// heaviest weight first within a priority
+func srvTargets(rrs []dns.RR) []SRVTarget {
+	var targets []SRVTarget
+	for _, rr := range rrs {
+		if srv, ok := rr.(*dns.SRV); ok {
+			target := strings.TrimSuffix(srv.Target, ".")
+			if target == "" {
+				target = "."
+			}
+			targets = append(targets, SRVTarget{Priority: srv.Priority, Weight: srv.Weight, Port: srv.Port, Target: target})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Priority != targets[j].Priority {
+			return targets[i].Priority < targets[j].Priority
+		}
+		if targets[i].Weight != targets[j].Weight {
+			return targets[i].Weight > targets[j].Weight
+		}
+		return targets[i].Target < targets[j].Target
+	})
+	return targets
+}
@@ -0,0 +1,129 @@
+package dnsaq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the counters reported at the end of a run. Fields are updated
+// atomically and read with Snapshot.
+type Stats struct {
+	// Queries counts every query sent to a resolver, retries and wildcard probes included
+	Queries int64
+	// Timeouts counts queries that got no reply in time
+	Timeouts int64
+	// Lookups and FailedLookups count lookups (shared lookups once) and
+	// those no resolver answered usefully; they feed the health check
+	Lookups       int64
+	FailedLookups int64
+	// Processed counts names whose lookups have finished
+	Processed int64
+	// Resolved, NXDomain and WildcardFiltered count lookups of input names by outcome
+	Resolved         int64
+	NXDomain         int64
+	WildcardFiltered int64
+	// CacheHits and CacheMisses count lookups served from, or missing in, the answer cache
+	CacheHits   int64
+	CacheMisses int64
+	// EDNSFallbacks counts resolvers that needed the non-EDNS fallback
+	// after answering FORMERR to an EDNS query
+	EDNSFallbacks int64
+}
+
+// Snapshot returns a consistent-enough copy of the counters for reporting
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Queries:          atomic.LoadInt64(&s.Queries),
+		Timeouts:         atomic.LoadInt64(&s.Timeouts),
+		Lookups:          atomic.LoadInt64(&s.Lookups),
+		FailedLookups:    atomic.LoadInt64(&s.FailedLookups),
+		Processed:        atomic.LoadInt64(&s.Processed),
+		Resolved:         atomic.LoadInt64(&s.Resolved),
+		NXDomain:         atomic.LoadInt64(&s.NXDomain),
+		WildcardFiltered: atomic.LoadInt64(&s.WildcardFiltered),
+		CacheHits:        atomic.LoadInt64(&s.CacheHits),
+		CacheMisses:      atomic.LoadInt64(&s.CacheMisses),
+		EDNSFallbacks:    atomic.LoadInt64(&s.EDNSFallbacks),
+	}
+}
+
+// countQuery records a query sent to a resolver and whether it timed out
+func (s *Stats) countQuery(err error) {
+	atomic.AddInt64(&s.Queries, 1)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		atomic.AddInt64(&s.Timeouts, 1)
+	}
+}
+
+// milliseconds converts a duration to fractional milliseconds for output
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// latencies collects the RTTs of answered queries per resolver
+type latencies struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+}
+
+// add records one RTT for resolver
+func (l *latencies) add(resolver string, rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.samples == nil {
+		l.samples = make(map[string][]time.Duration)
+	}
+	l.samples[resolver] = append(l.samples[resolver], rtt)
+}
+
+// percentiles returns the median and 95th percentile RTT for resolver along
+// with the number of samples
+func (l *latencies) percentiles(resolver string) (p50, p95 time.Duration, n int) {
+	l.mu.Lock()
+	sorted := append([]time.Duration{}, l.samples[resolver]...)
+	l.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0, 0, 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return at(0.50), at(0.95), len(sorted)
+}
+
+// reportStats prints the run summary to stderr
+func (d *DNSEnumerator) reportStats() {
+	stats := d.stats.Snapshot()
+	elapsed := time.Since(d.started)
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(stats.Queries) / elapsed.Seconds()
+	}
+
+	fmt.Fprintf(os.Stderr, "Stats: %d names processed, %d resolved, %d NXDOMAIN, %d wildcard filtered, %d failed\n",
+		stats.Processed, stats.Resolved, stats.NXDomain, stats.WildcardFiltered, stats.FailedLookups)
+	fmt.Fprintf(os.Stderr, "Stats: %d queries, %d timeouts in %v (%.1f queries/s)\n",
+		stats.Queries, stats.Timeouts, elapsed.Round(time.Millisecond), rate)
+	if d.cache != nil {
+		fmt.Fprintf(os.Stderr, "Stats: answer cache %d hits, %d misses\n", stats.CacheHits, stats.CacheMisses)
+	}
+	if stats.EDNSFallbacks > 0 {
+		fmt.Fprintf(os.Stderr, "Stats: %d resolvers needed the plain DNS fallback after FORMERR\n", stats.EDNSFallbacks)
+	}
+	for _, resolver := range d.Config.Resolvers {
+		if p50, p95, n := d.latency.percentiles(resolver); n > 0 {
+			fmt.Fprintf(os.Stderr, "Stats: %s latency p50=%v p95=%v over %d answers\n",
+				resolver, p50.Round(time.Microsecond), p95.Round(time.Microsecond), n)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package dnsaq
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestEDNSFallbackCounted(t *testing.T) {
+	// An old resolver that answers FORMERR to anything carrying an OPT record
+	server := newMockServer(t, func(_ string, w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		if r.IsEdns0() != nil {
+			m.SetRcode(r, dns.RcodeFormatError)
+		} else {
+			m.SetReply(r)
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	d := newTestEnumerator(t, []string{server.Addr}, func(config *DNSConfig) {
+		config.EDNSBufSize = 1232
+	})
+
+	records, err := d.Resolve("www.example.test")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if want := []string{"192.0.2.1"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Resolve = %v, want the plain DNS answer %v", records, want)
+	}
+
+	// Concurrent queries may all see the FORMERR before the first one marks
+	// the resolver; it still counts once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.markNoEDNS(server.Addr)
+		}()
+	}
+	wg.Wait()
+	if got := d.stats.Snapshot().EDNSFallbacks; got != 1 {
+		t.Errorf("EDNSFallbacks = %d, want 1 resolver", got)
+	}
+}
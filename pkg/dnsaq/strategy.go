@@ -0,0 +1,120 @@
+package dnsaq
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// tierPrefix marks a resolver entry's fallback tier, e.g. "tier:2 8.8.8.8"
+const tierPrefix = "tier:"
+
+// Resolver selection strategies accepted by -resolver-strategy
+const (
+	StrategyOrdered    = "ordered"
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+)
+
+// ParseResolverStrategy validates a resolver selection strategy name
+func ParseResolverStrategy(name string) (string, error) {
+	switch strategy := strings.ToLower(name); strategy {
+	case StrategyOrdered, StrategyRoundRobin, StrategyRandom:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown resolver strategy %q (supported: %s, %s, %s)", name, StrategyOrdered, StrategyRoundRobin, StrategyRandom)
+}
+
+// ParseResolverTier splits the "tier:N" prefix off a resolver entry,
+// returning the tier and the resolver. Entries without one are tier 1.
+func ParseResolverTier(entry string) (int, string, error) {
+	entry = strings.TrimSpace(entry)
+	if !strings.HasPrefix(strings.ToLower(entry), tierPrefix) {
+		return 1, entry, nil
+	}
+
+	fields := strings.Fields(entry)
+	tier, err := strconv.Atoi(fields[0][len(tierPrefix):])
+	if err != nil || tier < 1 {
+		return 0, "", fmt.Errorf("invalid resolver tier %q (want %s1, %s2, ...)", fields[0], tierPrefix, tierPrefix)
+	}
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("invalid resolver entry %q (want \"%sN resolver\")", entry, tierPrefix)
+	}
+	return tier, fields[1], nil
+}
+
+// resolverOrder returns the resolvers in the order a query should try them.
+// Every strategy still fails over through the whole list; they only differ
+// in where each query starts, which spreads load across providers. With
+// tiers, a tier is exhausted before the next is tried and the strategy
+// applies within each one.
+func (d *DNSEnumerator) resolverOrder() []string {
+	resolvers := d.Config.Resolvers
+	if len(resolvers) < 2 {
+		return resolvers
+	}
+
+	var turn uint64
+	if d.Config.ResolverStrategy == StrategyRoundRobin {
+		turn = atomic.AddUint64(&d.resolverCounter, 1) - 1
+	}
+	if !d.tiered {
+		return d.rotate(resolvers, turn)
+	}
+
+	order := make([]string, 0, len(resolvers))
+	for _, tier := range groupByTier(resolvers, d.Config.ResolverTiers) {
+		order = append(order, d.rotate(tier, turn)...)
+	}
+	return order
+}
+
+// rotate orders resolvers for one query by the -resolver-strategy; turn
+// counts the queries so far, for round-robin
+func (d *DNSEnumerator) rotate(resolvers []string, turn uint64) []string {
+	if len(resolvers) < 2 {
+		return resolvers
+	}
+
+	var start int
+	switch d.Config.ResolverStrategy {
+	case StrategyRoundRobin:
+		start = int(turn % uint64(len(resolvers)))
+	case StrategyRandom:
+		start = rand.Intn(len(resolvers))
+	default:
+		return resolvers
+	}
+
+	order := make([]string, 0, len(resolvers))
+	order = append(order, resolvers[start:]...)
+	return append(order, resolvers[:start]...)
+}
+
+// groupByTier splits resolvers into their tiers, lowest first, keeping the
+// list order within each. Resolvers missing from tiers are tier 1.
+func groupByTier(resolvers []string, tiers map[string]int) [][]string {
+	byTier := make(map[int][]string)
+	var numbers []int
+	for _, resolver := range resolvers {
+		tier := tiers[resolver]
+		if tier < 1 {
+			tier = 1
+		}
+		if _, ok := byTier[tier]; !ok {
+			numbers = append(numbers, tier)
+		}
+		byTier[tier] = append(byTier[tier], resolver)
+	}
+	sort.Ints(numbers)
+
+	groups := make([][]string, len(numbers))
+	for i, tier := range numbers {
+		groups[i] = byTier[tier]
+	}
+	return groups
+}
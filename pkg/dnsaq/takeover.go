@@ -0,0 +1,164 @@
+package dnsaq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// takeoverBodyLimit caps how much of a probed page is searched for a
+// fingerprint
+const takeoverBodyLimit = 64 << 10
+
+// Fingerprint says how to recognise an unclaimed resource on a hosting
+// service, in the layout of the can-i-take-over-xyz list
+type Fingerprint struct {
+	Service string `json:"service"`
+	// CNAME holds the target suffixes pointing at the service, e.g. github.io
+	CNAME []string `json:"cname"`
+	// NXDomain flags names whose CNAME target does not exist
+	NXDomain bool `json:"nxdomain"`
+	// Body flags names whose page at http://name/ contains this text
+	Body string `json:"fingerprint,omitempty"`
+}
+
+// Takeover is a -takeover candidate: a name aliased to a service that looks
+// unclaimed. It needs verifying by hand before anyone acts on it.
+type Takeover struct {
+	Service string `json:"service"`
+	// Target is the CNAME target that matched the service
+	Target string `json:"target"`
+	// Reason is "NXDOMAIN" or "fingerprint", the rule that matched
+	Reason string `json:"reason"`
+}
+
+// defaultFingerprints are the services -takeover knows when no
+// -fingerprints file is given
+var defaultFingerprints = []Fingerprint{
+	{Service: "AWS S3", CNAME: []string{"s3.amazonaws.com", "s3-website.amazonaws.com"}, Body: "The specified bucket does not exist"},
+	{Service: "AWS Elastic Beanstalk", CNAME: []string{"elasticbeanstalk.com"}, NXDomain: true},
+	{Service: "Azure", CNAME: []string{"azurewebsites.net", "cloudapp.net", "cloudapp.azure.com", "trafficmanager.net", "blob.core.windows.net", "azureedge.net", "azure-api.net"}, NXDomain: true},
+	{Service: "GitHub Pages", CNAME: []string{"github.io"}, Body: "There isn't a GitHub Pages site here."},
+	{Service: "Heroku", CNAME: []string{"herokuapp.com", "herokudns.com"}, NXDomain: true, Body: "No such app"},
+	{Service: "Bitbucket", CNAME: []string{"bitbucket.io"}, Body: "Repository not found"},
+	{Service: "Fastly", CNAME: []string{"fastly.net"}, Body: "Fastly error: unknown domain"},
+	{Service: "Ghost", CNAME: []string{"ghost.io"}, Body: "The thing you were looking for is no longer here"},
+	{Service: "Pantheon", CNAME: []string{"pantheonsite.io"}, Body: "The gods are wise"},
+	{Service: "Read the Docs", CNAME: []string{"readthedocs.io"}, Body: "unknown to Read the Docs"},
+	{Service: "Shopify", CNAME: []string{"myshopify.com"}, Body: "Sorry, this shop is currently unavailable"},
+	{Service: "Surge.sh", CNAME: []string{"surge.sh"}, Body: "project not found"},
+	{Service: "Tumblr", CNAME: []string{"domains.tumblr.com"}, Body: "Whatever you were looking for doesn't currently exist at this address"},
+	{Service: "Zendesk", CNAME: []string{"zendesk.com"}, Body: "Help Center Closed"},
+}
+
+// readFingerprints parses a -fingerprints file: a JSON array of
+// Fingerprint entries, each with a service, CNAME suffixes and a rule
+func readFingerprints(reader io.Reader) ([]Fingerprint, error) {
+	var fingerprints []Fingerprint
+	if err := json.NewDecoder(reader).Decode(&fingerprints); err != nil {
+		return nil, err
+	}
+	for i, fingerprint := range fingerprints {
+		if fingerprint.Service == "" || len(fingerprint.CNAME) == 0 {
+			return nil, fmt.Errorf("entry %d needs a service and at least one cname", i+1)
+		}
+		if !fingerprint.NXDomain && fingerprint.Body == "" {
+			return nil, fmt.Errorf("%s has neither nxdomain nor a fingerprint to match", fingerprint.Service)
+		}
+	}
+	return fingerprints, nil
+}
+
+// checkTakeover matches the CNAME chain of domain against the takeover
+// fingerprints. A dangling chain matches on its NXDOMAIN target; otherwise
+// the page served at the resolved addresses is fetched and searched.
+func (d *DNSEnumerator) checkTakeover(domain string, chain, addresses []string, dangling bool) *Takeover {
+	for _, target := range chain {
+		fingerprint := d.fingerprintFor(target)
+		if fingerprint == nil {
+			continue
+		}
+		if dangling {
+			if fingerprint.NXDomain {
+				return &Takeover{Service: fingerprint.Service, Target: target, Reason: "NXDOMAIN"}
+			}
+			continue
+		}
+		if fingerprint.Body != "" && d.pageContains(domain, addresses, fingerprint.Body) {
+			return &Takeover{Service: fingerprint.Service, Target: target, Reason: "fingerprint"}
+		}
+	}
+	return nil
+}
+
+// fingerprintFor returns the fingerprint whose CNAME suffix target falls
+// under, or nil
+func (d *DNSEnumerator) fingerprintFor(target string) *Fingerprint {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	for i, fingerprint := range d.fingerprints {
+		for _, suffix := range fingerprint.CNAME {
+			suffix = strings.ToLower(strings.Trim(suffix, "."))
+			if target == suffix || strings.HasSuffix(target, "."+suffix) {
+				return &d.fingerprints[i]
+			}
+		}
+	}
+	return nil
+}
+
+// pageContains fetches http://domain/ from the first address that
+// answers, without following redirects, and reports whether the start of
+// the page contains text
+func (d *DNSEnumerator) pageContains(domain string, addresses []string, text string) bool {
+	for _, address := range addresses {
+		if net.ParseIP(address) == nil {
+			continue
+		}
+		body, err := d.fetchPage(domain, address)
+		if err != nil {
+			if d.Config.Verbose {
+				fmt.Fprintf(os.Stderr, "Error fetching http://%s/ from %s: %v\n", domain, address, err)
+			}
+			continue
+		}
+		return strings.Contains(body, text)
+	}
+	return false
+}
+
+// fetchPage requests http://domain/ from address, so the page comes from
+// the host dnsaq resolved rather than whatever the system resolver says
+func (d *DNSEnumerator) fetchPage(domain, address string) (string, error) {
+	dialer := newDialer(d.Config, "tcp")
+	dialer.Timeout = dialTimeout(d.Config)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, net.JoinHostPort(address, "80"))
+		},
+		DisableKeepAlives: true,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   dialer.Timeout + d.Config.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, "http://"+domain+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, takeoverBodyLimit))
+	return string(body), err
+}
@@ -0,0 +1,318 @@
+package dnsaq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dohContentType is the media type of wire-format DNS messages over HTTPS (RFC 8484)
+const dohContentType = "application/dns-message"
+
+// Protocols accepted by -protocol for plain resolvers
+const (
+	// ProtocolAuto queries over UDP and re-asks truncated answers over TCP
+	ProtocolAuto = "auto"
+	ProtocolUDP  = "udp"
+	ProtocolTCP  = "tcp"
+)
+
+// ParseProtocol validates a -protocol name
+func ParseProtocol(name string) (string, error) {
+	switch protocol := strings.ToLower(name); protocol {
+	case ProtocolAuto, ProtocolUDP, ProtocolTCP:
+		return protocol, nil
+	}
+	return "", fmt.Errorf("unknown protocol %q (supported: %s, %s, %s)", name, ProtocolAuto, ProtocolUDP, ProtocolTCP)
+}
+
+// transport is how a resolver is reached
+type transport int
+
+const (
+	// transportPlain is classic DNS over UDP, with TCP for truncated answers
+	transportPlain transport = iota
+	// transportTLS is DNS-over-TLS (RFC 7858), given as tls://host[:port]
+	transportTLS
+	// transportHTTPS is DNS-over-HTTPS (RFC 8484), given as an https:// URL
+	transportHTTPS
+)
+
+// dotScheme prefixes DNS-over-TLS resolvers
+const dotScheme = "tls://"
+
+// resolverTransport splits a normalized resolver into its transport and the
+// address to dial (the URL itself for DNS-over-HTTPS). This is the one place
+// resolver strings are routed.
+func resolverTransport(resolver string) (transport, string) {
+	switch {
+	case strings.HasPrefix(resolver, "https://"):
+		return transportHTTPS, resolver
+	case strings.HasPrefix(resolver, dotScheme):
+		return transportTLS, strings.TrimPrefix(resolver, dotScheme)
+	}
+	return transportPlain, resolver
+}
+
+// NormalizeResolver validates a resolver as given in -resolvers or -r and
+// puts it in canonical form. Plain resolvers are host[:port], defaulting to
+// port 53; tls://host[:port] resolvers default to port 853; https:// URLs
+// are DNS-over-HTTPS endpoints.
+func NormalizeResolver(resolver string) (string, error) {
+	resolver = strings.TrimSpace(resolver)
+	entry := resolver
+
+	prefix, port := "", "53"
+	if strings.HasPrefix(resolver, dotScheme) {
+		prefix, port = dotScheme, "853"
+		resolver = strings.TrimPrefix(resolver, dotScheme)
+	} else if strings.Contains(resolver, "://") {
+		endpoint, err := url.Parse(resolver)
+		if err != nil {
+			return "", err
+		}
+		if endpoint.Scheme != "https" || endpoint.Host == "" {
+			return "", fmt.Errorf("unsupported resolver %q (want host[:port], tls://host[:port] or https://host/path)", resolver)
+		}
+		return resolver, nil
+	}
+
+	resolver = withDefaultPort(resolver, port)
+	host, portNum, err := net.SplitHostPort(resolver)
+	if err != nil {
+		return "", fmt.Errorf("invalid resolver %q: %v", entry, err)
+	}
+	if net.ParseIP(host) == nil && !validHostname(host) {
+		return "", fmt.Errorf("invalid resolver %q: %q is not an IP address or host name", entry, host)
+	}
+	if n, err := strconv.Atoi(portNum); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid resolver %q: bad port %q", entry, portNum)
+	}
+	return prefix + resolver, nil
+}
+
+// withDefaultPort appends port to a resolver given without one. Bare IPv6
+// addresses are bracketed so the colons in the address are not read as a port.
+func withDefaultPort(resolver, port string) string {
+	if net.ParseIP(resolver) != nil || !strings.Contains(resolver, ":") {
+		return net.JoinHostPort(resolver, port)
+	}
+	return resolver
+}
+
+// validHostname reports whether host is a syntactically valid DNS host name
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > MaxNameLength {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupHost resolves resolver host names for checkResolverHost; tests
+// replace it to stay off the network
+var lookupHost = net.LookupHost
+
+// checkResolverHost makes sure a resolver's host is an IP address or a name
+// that resolves, so a typo shows up at startup instead of at query time
+func checkResolverHost(resolver string) error {
+	kind, addr := resolverTransport(resolver)
+
+	var host string
+	if kind == transportHTTPS {
+		endpoint, err := url.Parse(addr)
+		if err != nil {
+			return err
+		}
+		host = endpoint.Hostname()
+	} else {
+		var err error
+		if host, _, err = net.SplitHostPort(addr); err != nil {
+			return err
+		}
+	}
+
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if _, err := lookupHost(host); err != nil {
+		return fmt.Errorf("host %s does not resolve", host)
+	}
+	return nil
+}
+
+// newHTTPClient builds the client used for DNS-over-HTTPS resolvers, with
+// the same dial and query timeouts as the UDP client
+func newHTTPClient(config *DNSConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := newDialer(config, "tcp")
+	dialer.Timeout = dialTimeout(config)
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = dialer.Timeout
+	return &http.Client{Transport: transport, Timeout: dialer.Timeout + config.Timeout}
+}
+
+// dialTimeout is the connection setup timeout: -dial-timeout, or the
+// query timeout when that is unset, or DefaultTimeout when neither is set
+func dialTimeout(config *DNSConfig) time.Duration {
+	if config.DialTimeout > 0 {
+		return config.DialTimeout
+	}
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+	return DefaultTimeout
+}
+
+// newDialer returns the dialer for connections of network ("udp" or "tcp"),
+// bound to -source-ip when one is set. It has no timeout of its own: a
+// dns.Client caps its read deadline at the dialer's timeout, so dial bounds
+// connection setup with a context instead.
+func newDialer(config *DNSConfig, network string) *net.Dialer {
+	dialer := &net.Dialer{}
+	if config.SourceIP == nil {
+		return dialer
+	}
+	if network == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{IP: config.SourceIP}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{IP: config.SourceIP}
+	}
+	return dialer
+}
+
+// ParseSourceIP validates a -source-ip address, making sure it belongs to
+// this host by binding to it
+func ParseSourceIP(addr string) (net.IP, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an IP address", addr)
+	}
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an address of this host: %v", ip, err)
+	}
+	conn.Close()
+	return ip, nil
+}
+
+// exchangeDoH POSTs msg in wire format to a DNS-over-HTTPS endpoint and
+// parses the reply
+func (d *DNSEnumerator) exchangeDoH(msg *dns.Msg, endpoint string) (*dns.Msg, time.Duration, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	start := time.Now()
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Since(start), fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, rtt, err
+	}
+
+	reply := &dns.Msg{}
+	if err := reply.Unpack(body); err != nil {
+		return nil, rtt, fmt.Errorf("bad DoH response: %v", err)
+	}
+	if reply.Id != msg.Id {
+		return nil, rtt, dns.ErrId
+	}
+	return reply, rtt, nil
+}
+
+// exchange sends msg to resolver, recording the query in the query log.
+// Every query we issue goes through here, zone transfers aside: encrypted
+// resolvers are routed to their own transport, plain ones use client.
+func (d *DNSEnumerator) exchange(client *dns.Client, msg *dns.Msg, resolver string) (*dns.Msg, time.Duration, error) {
+	query := msg
+	if d.Config.Randomize0x20 {
+		query = with0x20(msg)
+	}
+
+	var resp *dns.Msg
+	var rtt time.Duration
+	var err error
+	switch kind, address := resolverTransport(resolver); kind {
+	case transportHTTPS:
+		resp, rtt, err = d.exchangeDoH(query, address)
+	case transportTLS:
+		resp, rtt, err = d.exchangeOver(d.tlsClient, query, address)
+	default:
+		resp, rtt, err = d.exchangeOver(client, query, address)
+	}
+	if err == nil && query != msg {
+		if err = check0x20(query, resp, msg.Question[0].Name); err != nil {
+			resp = nil
+		}
+	}
+	d.stats.countQuery(err)
+	if err == nil {
+		if d.Config.Stats {
+			d.latency.add(resolver, rtt)
+		}
+		if d.Config.SlowThreshold > 0 && rtt > d.Config.SlowThreshold {
+			fmt.Fprintf(os.Stderr, "Slow query: %s %s via %s took %v\n",
+				strings.TrimSuffix(msg.Question[0].Name, "."), dns.TypeToString[msg.Question[0].Qtype], resolver, rtt.Round(time.Microsecond))
+		}
+	}
+	if d.queryLog != nil {
+		d.logQuery(msg, resolver, resp, rtt, err)
+	}
+	return resp, rtt, err
+}
+
+// dial connects client to address within the dial timeout. The connection
+// then carries the client's read and write timeouts, so a slow handshake
+// doesn't eat into the query timeout or the other way around.
+func (d *DNSEnumerator) dial(client *dns.Client, address string) (*dns.Conn, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, dialTimeout(d.Config))
+	defer cancel()
+	return client.DialContext(ctx, address)
+}
+
+// exchangeOver sends msg to address over a fresh connection from dial
+func (d *DNSEnumerator) exchangeOver(client *dns.Client, msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	conn, err := d.dial(client, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	return client.ExchangeWithConnContext(d.ctx, msg, conn)
+}
@@ -0,0 +1,104 @@
+package dnsaq
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// VerifyResolver checks that resolver answers honestly: control must
+// resolve to at least one address, and a random name under control's TLD,
+// which cannot exist, must come back NXDOMAIN. An address for the random
+// name is the mark of NXDOMAIN hijacking by captive portals, ISP "search
+// assist" pages or a poisoned resolver. It returns why the resolver is
+// suspect, or nil when it passed.
+func (d *DNSEnumerator) VerifyResolver(resolver, control string) error {
+	control = strings.TrimSuffix(control, ".")
+
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(control), dns.TypeA)
+	d.wait()
+	resp, _, err := d.exchange(d.client, msg, resolver)
+	if err != nil {
+		return fmt.Errorf("no answer for %s: %v", control, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("answered %s for %s, which must resolve", dns.RcodeToString[resp.Rcode], control)
+	}
+	if !hasAddress(resp.Answer) {
+		return fmt.Errorf("returned no address for %s, which must resolve", control)
+	}
+
+	tld := control[strings.LastIndex(control, ".")+1:]
+	missing := d.randomLabel() + "." + tld
+	msg = &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(missing), dns.TypeA)
+	d.wait()
+	resp, _, err = d.exchange(d.client, msg, resolver)
+	if err != nil {
+		return fmt.Errorf("no answer for %s: %v", missing, err)
+	}
+	if resp.Rcode != dns.RcodeNameError {
+		var records []string
+		for _, rr := range resp.Answer {
+			records = append(records, recordValue(rr))
+		}
+		if len(records) > 0 {
+			return fmt.Errorf("returned %s for %s, which must not exist", strings.Join(records, ", "), missing)
+		}
+		return fmt.Errorf("answered %s for %s, which must be NXDOMAIN", dns.RcodeToString[resp.Rcode], missing)
+	}
+	return nil
+}
+
+// VerifyResolvers checks every configured resolver with VerifyResolver
+// and drops the suspect ones from the run, warning about each on stderr.
+// It returns how many resolvers are left.
+func (d *DNSEnumerator) VerifyResolvers(control string) int {
+	failures := make([]error, len(d.Config.Resolvers))
+
+	// Resolver files can be long, so check them -concurrency at a time
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(d.Config.Concurrency, 1))
+	for i, resolver := range d.Config.Resolvers {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, resolver string) {
+			defer wg.Done()
+			failures[i] = d.VerifyResolver(resolver, control)
+			<-slots
+		}(i, resolver)
+	}
+	wg.Wait()
+
+	var kept []string
+	for i, resolver := range d.Config.Resolvers {
+		if failures[i] == nil {
+			kept = append(kept, resolver)
+			continue
+		}
+		if !d.quiet() {
+			fmt.Fprintf(os.Stderr, "[!] Dropping resolver %s: %v\n", resolver, failures[i])
+		}
+	}
+	if d.Config.Verbose {
+		fmt.Fprintf(os.Stderr, "Verified %d of %d resolvers\n", len(kept), len(d.Config.Resolvers))
+	}
+
+	d.Config.Resolvers = kept
+	return len(kept)
+}
+
+// hasAddress reports whether an answer section holds an A or AAAA record
+func hasAddress(answers []dns.RR) bool {
+	for _, rr := range answers {
+		switch rr.(type) {
+		case *dns.A, *dns.AAAA:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package dnsaq
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// webhookBatchSize is how much output the -webhook sink buffers before
+	// posting; smaller batches go out with the periodic flush
+	webhookBatchSize = 64 << 10
+	// webhookQueue is how many batches may wait for the poster; batches
+	// beyond it are dropped rather than holding up output
+	webhookQueue = 16
+	// webhookTimeout bounds each POST
+	webhookTimeout = 10 * time.Second
+)
+
+var errWebhookClosed = errors.New("webhook closed")
+
+// webhookWriter receives the JSON Lines of the -webhook sink and POSTs them
+// in batches from a goroutine of its own, so a slow endpoint does not hold
+// up the other sinks. Batches always end on a line break. Write and Close
+// are called under the enumerator's mutex.
+type webhookWriter struct {
+	url string
+	// host names the endpoint in errors, which keeps tokens in the URL out
+	// of the logs
+	host    string
+	client  *http.Client
+	pending []byte
+	closed  bool
+	// dropped counts the results in batches that found the queue full
+	dropped int
+	batches chan []byte
+	done    chan struct{}
+}
+
+// newWebhookSink starts a webhook poster for endpoint and returns the sink
+// feeding it
+func newWebhookSink(endpoint string) (*outputSink, *webhookWriter, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, nil, fmt.Errorf("invalid webhook URL %q (want http:// or https://)", endpoint)
+	}
+
+	webhook := &webhookWriter{
+		url:     endpoint,
+		host:    parsed.Host,
+		client:  &http.Client{Timeout: webhookTimeout},
+		batches: make(chan []byte, webhookQueue),
+		done:    make(chan struct{}),
+	}
+	go webhook.post()
+
+	sink := &outputSink{
+		writer:      bufio.NewWriterSize(webhook, webhookBatchSize),
+		format:      FormatJSON,
+		resultsOnly: true,
+	}
+	return sink, webhook, nil
+}
+
+// Write queues the complete lines of p as a batch, holding back a trailing
+// partial line until the rest of it arrives. A batch that finds the queue
+// full is dropped, since waiting would stall every sink behind the mutex.
+func (w *webhookWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWebhookClosed
+	}
+	w.pending = append(w.pending, p...)
+	if end := bytes.LastIndexByte(w.pending, '\n'); end >= 0 {
+		batch := make([]byte, end+1)
+		copy(batch, w.pending)
+		w.pending = append(w.pending[:0], w.pending[end+1:]...)
+		select {
+		case w.batches <- batch:
+		default:
+			w.dropped += bytes.Count(batch, []byte{'\n'})
+		}
+	}
+	return len(p), nil
+}
+
+// Close waits until every queued batch has been posted
+func (w *webhookWriter) Close() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.batches)
+	<-w.done
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Webhook endpoint %s fell behind; %d results were not posted\n", w.host, w.dropped)
+	}
+}
+
+// post sends the queued batches in order until the writer is closed
+func (w *webhookWriter) post() {
+	defer close(w.done)
+	for batch := range w.batches {
+		if err := w.send(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting results to webhook: %v\n", err)
+		}
+	}
+}
+
+// send POSTs one batch of JSON Lines
+func (w *webhookWriter) send(batch []byte) error {
+	resp, err := w.client.Post(w.url, "application/x-ndjson", bytes.NewReader(batch))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %v", w.host, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", w.host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package dnsaq
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookWriteDoesNotBlockOnSlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-release
+	}))
+	defer endpoint.Close()
+
+	_, webhook, err := newWebhookSink(endpoint.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One batch is being posted and webhookQueue wait; the rest overflow
+	written := make(chan struct{})
+	go func() {
+		for i := 0; i < webhookQueue+10; i++ {
+			webhook.Write([]byte("{\"domain\":\"a.example.com\"}\n"))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked on a stalled endpoint")
+	}
+
+	close(release)
+	webhook.Close()
+	if webhook.dropped == 0 {
+		t.Error("no results counted as dropped")
+	}
+}
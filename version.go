@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, overridden at build time:
+//
+//	go build -ldflags "-X main.buildVersion=v1.1.0 -X main.buildCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	buildVersion = "dev"
+	buildCommit  = ""
+	buildDate    = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns the build metadata, falling back to what the Go
+// toolchain embedded (module version, VCS revision and time) for fields
+// that were not set with -ldflags
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   buildVersion,
+		Commit:    buildCommit,
+		Date:      buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+	for _, setting := range embedded.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "":
+			info.Date = setting.Value
+		}
+	}
+	return info
+}
+
+// String renders the build info for -version
+func (b BuildInfo) String() string {
+	s := "DNS Tool " + b.Version
+	if b.Commit != "" {
+		s += " (commit " + b.Commit
+		if b.Date != "" {
+			s += ", built " + b.Date
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s %s", s, b.GoVersion, b.Platform)
+}
+
+// JSON renders the build info for -version-json
+func (b BuildInfo) JSON() string {
+	encoded, _ := json.Marshal(b)
+	return string(encoded)
+}